@@ -6,6 +6,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,7 +14,9 @@ import (
         "strings"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/RedisLabs/RediSearchBenchmark/index/redisearch"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
+	"github.com/RedisLabs/RediSearchBenchmark/synth"
 )
 
 var latencyPool [100000]int     // 0-100000 0.1ms
@@ -21,6 +24,15 @@ var longtail []float64
 var mutex = &sync.Mutex{}
 var nextquery uint64
 
+// partialResponses counts searches answered by only some of the shards
+var partialResponses uint64
+
+// shardStats collects per shard latencies of searches when set
+var shardStats *ShardStats
+
+// serverTimes collects the server side times of searches when set
+var serverTimes *ServerTimes
+
 // SearchBenchmark returns a closure of a function for the benchmarker to run, using a given index
 // and options, on a set of queries
 func SearchBenchmark(queries []string, idx index.Index, opts interface{}) func(int) error {
@@ -34,7 +46,20 @@ func SearchBenchmark(queries []string, idx index.Index, opts interface{}) func(i
                 q := query.NewQuery(IndexName, queries[int(next_id) % len(queries)]).Limit(0, 5)
 		st := time.Now()
                 //_, took, err := idx.Search(*q)  //Single Query, cares about the latency
-                _, _, err := idx.Search(*q)     //Multiuple queries
+		var err error
+		if sd, ok := idx.(ShardDebugger); ok && shardStats != nil {
+			var shards []redisearch.ShardInfo
+			_, _, shards, err = sd.SearchDebug(*q)
+			shardStats.Record(shards)
+		} else if ts, ok := idx.(index.TimedSearcher); ok && serverTimes != nil {
+			var res index.SearchResponse
+			res, err = ts.SearchTimed(*q)
+			if err == nil {
+				serverTimes.Record(res.Took, time.Since(st))
+			}
+		} else {
+			_, _, err = idx.Search(*q) //Multiuple queries
+		}
                 latency := time.Since(st).Nanoseconds()/100000   //Multiple queries
                 //latency = int64(took)                 // Single Query 
                 if latency > 99999 {
@@ -44,18 +69,270 @@ func SearchBenchmark(queries []string, idx index.Index, opts interface{}) func(i
                        latencyPool[latency] += 1
                 }
                 counter++
+		// partial results are a valid response, we just count them
+		if _, partial := err.(*redisearch.PartialResultError); partial {
+			atomic.AddUint64(&partialResponses, 1)
+			err = nil
+		}
 		return err
 	}
 }
 
+// ShardDebugger is implemented by sharded indexes that can report how each shard did in a search
+type ShardDebugger interface {
+	SearchDebug(q query.Query) ([]index.Document, int, []redisearch.ShardInfo, error)
+}
+
+// stragglerFactor is how much higher than the median shard's 99th percentile latency a shard's one must be for
+// the shard to be reported as a straggler
+const stragglerFactor = 1.5
+
+// shardStat is the latency histogram and counters of a single shard
+type shardStat struct {
+	latencies [100000]int // 0-100000 0.1ms
+	searches  int
+	errors    int
+	results   int
+	// slowest is the number of searches this shard was the slowest to answer
+	slowest int
+}
+
+// percentile returns the latency under which the given fraction of the shard's searches answered, in ms
+func (s *shardStat) percentile(p float64) float64 {
+	target := int(p * float64(s.searches))
+	pos := 0
+	for n, c := range s.latencies {
+		if pos += c; c > 0 && pos >= target {
+			return float64(n) / 10
+		}
+	}
+	return float64(len(s.latencies)) / 10
+}
+
+// ShardStats aggregates the per shard latencies of the searches of a benchmark
+type ShardStats struct {
+	mtx    sync.Mutex
+	shards map[int]*shardStat
+}
+
+// NewShardStats creates an empty per shard latency collector
+func NewShardStats() *ShardStats {
+	return &ShardStats{shards: map[int]*shardStat{}}
+}
+
+// Record adds the shard infos of a single search
+func (s *ShardStats) Record(shards []redisearch.ShardInfo) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	slowest := -1
+	var max time.Duration
+	for _, sh := range shards {
+		st, found := s.shards[sh.Partition]
+		if !found {
+			st = &shardStat{}
+			s.shards[sh.Partition] = st
+		}
+		st.searches++
+		st.results += sh.Results
+		if sh.Err != nil {
+			st.errors++
+		}
+		latency := sh.Latency.Nanoseconds() / 100000
+		if latency > 99999 {
+			latency = 99999
+		}
+		st.latencies[latency]++
+		if sh.Latency > max {
+			slowest, max = sh.Partition, sh.Latency
+		}
+	}
+	if slowest >= 0 {
+		s.shards[slowest].slowest++
+	}
+}
+
+// Print writes a table of the latency percentiles of each shard, marking the shards whose 99th percentile
+// latency is well above the median one as stragglers
+func (s *ShardStats) Print(out io.Writer) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	ids := make([]int, 0, len(s.shards))
+	p99s := make([]float64, 0, len(s.shards))
+	for id, st := range s.shards {
+		ids = append(ids, id)
+		p99s = append(p99s, st.percentile(0.99))
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Ints(ids)
+	sort.Float64s(p99s)
+	median := p99s[len(p99s)/2]
+
+	fmt.Fprintln(out, "Shard latencies (ms):")
+	fmt.Fprintf(out, "%6s %8s %8s %8s %8s %10s %8s\n", "shard", "p50", "p95", "p99", "errors", "avgresults", "slowest")
+	for _, id := range ids {
+		st := s.shards[id]
+		p99 := st.percentile(0.99)
+		fmt.Fprintf(out, "%6d %8.1f %8.1f %8.1f %8d %10.1f %7.1f%%", id, st.percentile(0.5), st.percentile(0.95), p99,
+			st.errors, float64(st.results)/float64(st.searches), 100*float64(st.slowest)/float64(st.searches))
+		if len(ids) > 1 && p99 > median*stragglerFactor {
+			fmt.Fprint(out, "  <- straggler")
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// ServerTimes compares the time engines report spending on searches with the round trip time of the same searches
+// seen by the client
+type ServerTimes struct {
+	mtx    sync.Mutex
+	server shardStat
+	client shardStat
+	// total server and client times, for the averages
+	serverTotal time.Duration
+	clientTotal time.Duration
+}
+
+// NewServerTimes creates an empty server time collector
+func NewServerTimes() *ServerTimes {
+	return &ServerTimes{}
+}
+
+// Record adds the server side time and the client round trip time of a single search
+func (s *ServerTimes) Record(server, client time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, r := range []struct {
+		st *shardStat
+		d  time.Duration
+	}{{&s.server, server}, {&s.client, client}} {
+		latency := r.d.Nanoseconds() / 100000
+		if latency > 99999 {
+			latency = 99999
+		}
+		r.st.latencies[latency]++
+		r.st.searches++
+	}
+	s.serverTotal += server
+	s.clientTotal += client
+}
+
+// Print writes the percentiles and averages of the server side and round trip times. Their difference is the time
+// spent on the network, in queues and parsing replies
+func (s *ServerTimes) Print(out io.Writer) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.server.searches == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "Search times (ms):")
+	fmt.Fprintf(out, "%10s %8s %8s %8s %8s\n", "", "p50", "p95", "p99", "avg")
+	n := time.Duration(s.server.searches)
+	fmt.Fprintf(out, "%10s %8.1f %8.1f %8.1f %8.2f\n", "server", s.server.percentile(0.5), s.server.percentile(0.95),
+		s.server.percentile(0.99), float64(s.serverTotal/n)/float64(time.Millisecond))
+	fmt.Fprintf(out, "%10s %8.1f %8.1f %8.1f %8.2f\n", "roundtrip", s.client.percentile(0.5), s.client.percentile(0.95),
+		s.client.percentile(0.99), float64(s.clientTotal/n)/float64(time.Millisecond))
+}
+
+// Aggregator is implemented by indexes that can run aggregations
+type Aggregator interface {
+	AggregateAll(a *redisearch.Aggregation) ([]redisearch.AggregateRow, error)
+}
+
+// AggregateBenchmark returns a closure of a function for the benchmarker to run, running the
+// aggregations of the pool in turn and reading all their results
+func AggregateBenchmark(aggs []*redisearch.Aggregation, ag Aggregator) func(int) error {
+	return func(client_id int) error {
+		mutex.Lock()
+		next_id := nextquery
+		nextquery += 1
+		mutex.Unlock()
+		st := time.Now()
+		_, err := ag.AggregateAll(aggs[int(next_id)%len(aggs)])
+		recordLatency(st)
+		return err
+	}
+}
+
+// SpellChecker is implemented by indexes that can suggest corrections to misspelled queries
+type SpellChecker interface {
+	SpellCheck(q string, opts redisearch.SpellCheckOptions) ([]redisearch.MisspelledTerm, error)
+	// LoadDictionary loads a custom dictionary, whose terms can be included in suggestions
+	LoadDictionary(dict, fileName string) error
+}
+
+// SynonymLoader is implemented by indexes that can load synonym groups
+type SynonymLoader interface {
+	LoadSynonyms(fileName string) error
+}
+
+// SpellCheckBenchmark returns a closure of a function for the benchmarker to run, spell checking
+// the queries of the pool in turn
+func SpellCheckBenchmark(queries []string, sc SpellChecker, opts redisearch.SpellCheckOptions) func(int) error {
+	return func(client_id int) error {
+		mutex.Lock()
+		next_id := nextquery
+		nextquery += 1
+		mutex.Unlock()
+		st := time.Now()
+		_, err := sc.SpellCheck(queries[int(next_id)%len(queries)], opts)
+		recordLatency(st)
+		return err
+	}
+}
+
+// misspell returns a variant of the query with a random typo - a deleted, duplicated, swapped
+// or replaced letter - in one of its words
+func misspell(q string, rng *rand.Rand) string {
+	words := strings.Fields(q)
+	if len(words) == 0 {
+		return q
+	}
+	n := rng.Intn(len(words))
+	w := []rune(words[n])
+	if len(w) < 2 {
+		return q
+	}
+	pos := rng.Intn(len(w) - 1)
+	switch rng.Intn(4) {
+	case 0:
+		w = append(w[:pos:pos], w[pos+1:]...)
+	case 1:
+		w = append(append(w[:pos+1:pos+1], w[pos]), w[pos+1:]...)
+	case 2:
+		w[pos], w[pos+1] = w[pos+1], w[pos]
+	default:
+		w[pos] = rune('a' + rng.Intn(26))
+	}
+	words[n] = string(w)
+	return strings.Join(words, " ")
+}
+
+// recordLatency records the latency of a request started at st in the latency histogram
+func recordLatency(st time.Time) {
+	latency := time.Since(st).Nanoseconds() / 100000
+	mutex.Lock()
+	if latency > 99999 {
+		longtail = append(longtail, float64(latency)/10)
+	} else {
+		latencyPool[latency] += 1
+	}
+	mutex.Unlock()
+}
+
 // AutocompleteBenchmark returns a configured autocomplete benchmarking function to be run by
-// the benchmarker
-func AutocompleteBenchmark(ac index.Autocompleter, fuzzy bool) func(int) error {
-	counter := 0
-	sz := len(prefixes)
+// the benchmarker. Each client types the prefixes of queries picked by the generator
+func AutocompleteBenchmark(ac index.Autocompleter, gen *synth.PrefixGenerator, fuzzy bool) func(int) error {
 	return func(client_id int) error {
-		_, err := ac.Suggest(prefixes[rand.Intn(sz)], 5, fuzzy)
-		counter++
+		_, err := ac.Suggest(gen.Next(client_id), 5, fuzzy)
+		if _, partial := err.(*redisearch.PartialResultError); partial {
+			atomic.AddUint64(&partialResponses, 1)
+			err = nil
+		}
 		return err
 	}
 }
@@ -151,6 +428,7 @@ func Benchmark(concurrency int, duration time.Duration, engine, title string, ou
         fmt.Print("Throughput: ", rate, "\n")
         fmt.Print("Latencies: ", lat_median, ", ", lat_95, ", ", lat_99, "\n")
         fmt.Print("Positions: ", pos_median, ", ", pos_95, ", ", pos_99, "\n")
+	fmt.Print("Partial responses: ", partialResponses, "\n")
 	// Output the results to CSV
 	w := csv.NewWriter(out)
 	err = w.Write([]string{engine, title,
@@ -161,6 +439,7 @@ func Benchmark(concurrency int, duration time.Duration, engine, title string, ou
 		fmt.Sprintf("%.02f", lat_median),
 		fmt.Sprintf("%.02f", lat_95),
 		fmt.Sprintf("%.02f", lat_99),
+		fmt.Sprintf("%d", partialResponses),
                 })
 
         //for i:=0; i < 100000; i++ {
@@ -0,0 +1,132 @@
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// maxBulkErrors is the number of failed documents whose errors are kept for reporting
+const maxBulkErrors = 100
+
+// BulkItemError is the error of a document the cluster failed to index, after any retries
+type BulkItemError struct {
+	Id     string
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e BulkItemError) Error() string {
+	return fmt.Sprintf("document %s: %d %s: %s", e.Id, e.Status, e.Type, e.Reason)
+}
+
+// BulkStats are the counts of the bulk processor since documents were first indexed
+type BulkStats struct {
+	// Bulks is the number of bulk requests sent, including retries
+	Bulks int64
+	// Indexed and Failed are the numbers of documents indexed and failed for good
+	Indexed int64
+	Failed  int64
+	// Errors are the errors of the first failed documents
+	Errors []BulkItemError
+}
+
+// bulkIndexer indexes documents in the background with an elastic bulk processor, started on first use
+type bulkIndexer struct {
+	once sync.Once
+	proc *elastic.BulkProcessor
+	err  error
+
+	mtx    sync.Mutex
+	failed int64
+	errs   []BulkItemError
+	// reported is the number of failures already returned by flush
+	reported int64
+}
+
+// start starts the bulk processor. Add blocks while all workers are busy sending bulks, which throttles indexing
+// to what the cluster can take
+func (b *bulkIndexer) start(conn *elastic.Client, name string, opts BulkOptions) error {
+	b.once.Do(func() {
+		b.proc, b.err = conn.BulkProcessor().
+			Name(name + "-bulk").
+			Workers(opts.Workers).
+			BulkActions(opts.Actions).
+			BulkSize(opts.Bytes).
+			FlushInterval(opts.FlushInterval).
+			RetryItemStatusCodes(http.StatusTooManyRequests).
+			Backoff(elastic.NewExponentialBackoff(opts.RetryBackoff, opts.MaxRetryBackoff)).
+			After(b.after).
+			Stats(true).
+			Do(context.Background())
+	})
+	return b.err
+}
+
+// after records the documents of a bulk that failed for good
+func (b *bulkIndexer) after(id int64, reqs []elastic.BulkableRequest, res *elastic.BulkResponse, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	// the whole bulk failed, e.g. after running out of retries
+	if err != nil {
+		b.failed += int64(len(reqs))
+		if len(b.errs) < maxBulkErrors {
+			b.errs = append(b.errs, BulkItemError{Id: fmt.Sprintf("bulk %d", id), Reason: err.Error()})
+		}
+		return
+	}
+	if res == nil {
+		return
+	}
+	for _, item := range res.Failed() {
+		b.failed++
+		if len(b.errs) >= maxBulkErrors {
+			continue
+		}
+		e := BulkItemError{Id: item.Id, Status: item.Status}
+		if item.Error != nil {
+			e.Type, e.Reason = item.Error.Type, item.Error.Reason
+		}
+		b.errs = append(b.errs, e)
+	}
+}
+
+// flush sends the pending documents and waits for all bulks to complete. It returns an error if documents failed
+// since the previous flush
+func (b *bulkIndexer) flush() error {
+	if b.proc == nil {
+		return nil
+	}
+	if err := b.proc.Flush(); err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if n := b.failed - b.reported; n > 0 {
+		b.reported = b.failed
+		return fmt.Errorf("%d documents failed to index, e.g. %v", n, b.errs[len(b.errs)-1])
+	}
+	return nil
+}
+
+// stats returns the bulk processor counts
+func (b *bulkIndexer) stats() BulkStats {
+	var ret BulkStats
+	if b.proc != nil {
+		s := b.proc.Stats()
+		ret.Bulks = s.Committed
+		ret.Indexed = s.Succeeded
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	ret.Failed = b.failed
+	ret.Errors = append([]BulkItemError(nil), b.errs...)
+	return ret
+}
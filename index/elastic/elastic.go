@@ -1,28 +1,38 @@
 package elastic
 
 import (
-	//"encoding/json"
+	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"time"
         "fmt"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
-	"gopkg.in/olivere/elastic.v3"
+	"github.com/olivere/elastic/v7"
 )
 
-// Index is an ElasticSearch index
+// Index is an ElasticSearch index, using the typeless APIs of Elasticsearch 7 and later and of OpenSearch
 type Index struct {
 	conn *elastic.Client
 
 	md   *index.Metadata
 	name string
-	typ  string
+	// suggestDistance is the maximal edit distance of fuzzy suggestions
+	suggestDistance int
+	// trackTotalHits is the number of hits counted exactly by searches, 0 for the default and negative for all
+	trackTotalHits int
+	bulk           bulkIndexer
 }
 
-// NewIndex creates a new elasticSearch index with the given address and name. typ is the entity type
-func NewIndex(addr, name, typ string, md *index.Metadata) (*Index, error) {
+// defaultSuggestDistance is the maximal edit distance of fuzzy suggestions, the same as RediSearch's
+const defaultSuggestDistance = 1
+
+// NewIndex creates a new elasticSearch index with the given address and name. The index is configured by the
+// IndexOptions in the metadata's Options, or by DefaultIndexOptions if there are none
+func NewIndex(addr, name string, md *index.Metadata) (*Index, error) {
 
 	fmt.Println("Get a new index: ", addr, name)
         client := &http.Client{
@@ -32,7 +42,8 @@ func NewIndex(addr, name, typ string, md *index.Metadata) (*Index, error) {
 		},
 		Timeout: 2500000 * time.Millisecond,
 	}
-	conn, err := elastic.NewClient(elastic.SetURL(addr), elastic.SetHttpClient(client))
+	// sniffing resolves the nodes' published addresses, which are often not reachable from the benchmark host
+	conn, err := elastic.NewClient(elastic.SetURL(addr), elastic.SetHttpClient(client), elastic.SetSniff(false))
 	if err != nil {
                 fmt.Println("Get error here");
 		return nil, err
@@ -41,7 +52,8 @@ func NewIndex(addr, name, typ string, md *index.Metadata) (*Index, error) {
 		conn: conn,
 		md:   md,
 		name: name,
-		typ:  typ,
+
+		suggestDistance: defaultSuggestDistance,
 	}
         fmt.Println("get here ======");
 
@@ -49,17 +61,25 @@ func NewIndex(addr, name, typ string, md *index.Metadata) (*Index, error) {
 
 }
 
+// SetSuggestDistance sets the maximal edit distance (0 to 2) between prefixes and fuzzy suggestions
+func (i *Index) SetSuggestDistance(distance int) {
+	i.suggestDistance = distance
+}
+
 type mappingProperty map[string]interface{}
 
 type mapping struct {
 	Properties map[string]mappingProperty `json:"properties"`
 }
 
+// highlight fetches highlighted bodies along with search results
+const highlight = false
+
 // convert a fieldType to elastic mapping type string
 func fieldTypeString(f index.FieldType) (string, error) {
 	switch f {
 	case index.TextField:
-		return "string", nil
+		return "text", nil
 	case index.NumericField:
 		return "double", nil
 	default:
@@ -67,134 +87,117 @@ func fieldTypeString(f index.FieldType) (string, error) {
 	}
 }
 
-// Create creates the index and posts a mapping corresponding to our Metadata
+// Create creates the index with the settings of the metadata's IndexOptions, and posts a mapping corresponding to
+// our Metadata
 func (i *Index) Create() error {
+	opts := indexOptions(i.md.Options)
 
 	doc := mapping{Properties: map[string]mappingProperty{}}
 	for _, f := range i.md.Fields {
-		doc.Properties[f.Name] = mappingProperty{}
+		if f.Type == index.NoIndexField {
+			continue
+		}
 		fs, err := fieldTypeString(f.Type)
 		if err != nil {
 			return err
 		}
-		doc.Properties[f.Name]["type"] = fs
+		prop := mappingProperty{"type": fs}
+		if a, ok := opts.Fields[f.Name]; ok && f.Type == index.TextField {
+			if a.Analyzer != "" {
+				prop["analyzer"] = a.Analyzer
+			}
+			if a.SearchAnalyzer != "" {
+				prop["search_analyzer"] = a.SearchAnalyzer
+			}
+			if a.IndexOptions != "" {
+				prop["index_options"] = a.IndexOptions
+			}
+		}
+		doc.Properties[f.Name] = prop
 	}
 
-        // Added for apple to apple benchmark
-        doc.Properties["body"]["type"] = "text"
-        doc.Properties["body"]["analyzer"] = "my_english_analyzer"
-        doc.Properties["body"]["search_analyzer"] = "whitespace"
-        doc.Properties["body"]["index_options"] = "offsets"
-        //doc.Properties["body"]["test"] = "test"
-        index_map := map[string]int{
-              "number_of_shards" : 1,
-              "number_of_replicas" : 0,
-        }
-        analyzer_map := map[string]interface{}{
-                  "my_english_analyzer": map[string]interface{}{
-                      "tokenizer":  "standard",
-                      "char_filter":  []string{ "html_strip" } ,
-                      "filter" : []string{"english_possessive_stemmer", 
-                                  "lowercase", "english_stop", 
-                                  "english_stemmer", 
-                                  "asciifolding", "icu_folding"},
-                  },
-              }
-        filter_map := map[string]interface{}{
-                  "english_stop": map[string]interface{}{
-                        "type":       "stop",
-                        "stopwords":  "_english_",
-                  },
-                  "english_possessive_stemmer": map[string]interface{}{
-                        "type":       "stemmer",
-                        "language":   "possessive_english",
-                  },
-                  "english_stemmer" : map[string]interface{}{
-                        "type" : "stemmer",
-                        "name" : "english",
-                  },
-                  "my_folding": map[string]interface{}{
-                        "type": "asciifolding",
-                        "preserve_original": "false",
-                  },
-              }
-        analysis_map := map[string]interface{}{
-              "analyzer": analyzer_map,
-              "filter"  : filter_map,
-        }
-        settings := map[string]interface{}{
-               "index": index_map,
-               "analysis": analysis_map,
-        }
-
-        // TODO delete?
-	// we currently manually create the autocomplete mapping
-	/*ac := mapping{
-		Properties: map[string]mappingProperty{
-			"sugg": mappingProperty{
-				"type":     "completion",
-				"payloads": true,
-			},
-		},
-	}*/
-
-	mappings := map[string]mapping{
-		i.typ:          doc,
-                //	"autocomplete": ac,
+	_, err := i.conn.CreateIndex(i.name).
+		BodyJson(map[string]interface{}{"mappings": doc, "settings": opts.settings()}).Do(context.Background())
+	if err != nil {
+		return err
 	}
 
-        fmt.Println(mappings)
+	return i.createSuggestIndex()
+}
 
-	//_, err := i.conn.CreateIndex(i.name).BodyJson(map[string]interface{}{"mappings": mappings}).Do()
-	_, err := i.conn.CreateIndex(i.name).BodyJson(map[string]interface{}{"mappings": mappings, "settings": settings}).Do()
+// suggestIndex returns the name of the index holding the suggestions, kept apart from the documents so the
+// autocompleter can be deleted on its own
+func (i *Index) suggestIndex() string {
+	return i.name + "-" + autocompleteType
+}
 
-        if err != nil {
-                fmt.Println("Error ", err)
-		fmt.Println("!!!!Get Error when using client to create index")
+// createSuggestIndex creates the suggestion index with its completion mapping
+func (i *Index) createSuggestIndex() error {
+	// suggestions are matched on their lowercase words, like RediSearch does
+	ac := mapping{
+		Properties: map[string]mappingProperty{
+			"sugg": {
+				"type":            "completion",
+				"analyzer":        "simple",
+				"search_analyzer": "simple",
+			},
+			"payload": {
+				"type":  "keyword",
+				"index": false,
+			},
+		},
 	}
-
+	_, err := i.conn.CreateIndex(i.suggestIndex()).
+		BodyJson(map[string]interface{}{"mappings": ac}).Do(context.Background())
 	return err
 }
 
-// Index indexes multiple documents
+// Index queues documents to the background bulk processor, blocking while all its bulks are in flight. Documents
+// the cluster fails to index are reported by Refresh and BulkStats
 func (i *Index) Index(docs []index.Document, opts interface{}) error {
-        blk := i.conn.Bulk()
+	if err := i.bulk.start(i.conn, i.name, indexOptions(i.md.Options).Bulk); err != nil {
+		return err
+	}
 	for _, doc := range docs {
-                //fmt.Println("indexing ", doc.Id)
-		req := elastic.NewBulkIndexRequest().Index(i.name).Type("doc").Id(doc.Id).Doc(doc.Properties)
-		blk.Add(req)
-		/*_, err := i.conn.Index().Index(i.name).Type("doc").Id(doc.Id).BodyJson(doc.Properties).Do()
-                if err != nil {
-                        // Handle error
-                        panic(err)
-                }*/
-                //fmt.Printf("Indexed tweet %s to index %s, type %s\n", put2.Id, put2.Index, put2.Type)
+		i.bulk.proc.Add(elastic.NewBulkIndexRequest().Index(i.name).Id(doc.Id).Doc(doc.Properties))
 	}
-	//_, err := blk.Refresh(true).Do()
-	_, err := blk.Refresh(false).Do()
-        if err != nil {
-                panic(err)
-                fmt.Println("Get Error during indexing", err)
-        }
-	return err
-	//return nil
+	return nil
 }
 
-// Refresh the index
+// Refresh sends the queued documents, waits for them to be indexed and refreshes the index so they are searchable
 func (i *Index) Refresh() error {
-	_, _ = i.conn.Flush().Index(i.name).Do()
-        return nil
+	if err := i.bulk.flush(); err != nil {
+		return err
+	}
+	_, err := i.conn.Refresh(i.name).Do(context.Background())
+	return err
+}
+
+// BulkStats returns the counts and errors of the bulk indexing of documents
+func (i *Index) BulkStats() BulkStats {
+	return i.bulk.stats()
 }
 
 // Search searches the index for the given query, and returns documents,
 // the total number of results, or an error if something went wrong
 func (i *Index) Search(q query.Query) ([]index.Document, int, error) {
-        Flag_highlight := false
-	eq := elastic.NewMatchQuery("body", q.Term).Analyzer("whitespace").Operator("and")    //Simple AND query
-        if (q.Term[0] == '"') {
-            q.Term = q.Term[1:len(q.Term)-1]
-            eq = elastic.NewMatchPhraseQuery("body", q.Term).Analyzer("whitespace").Slop(0)      //Phrase Query
-        }
+	res, err := i.SearchTimed(q)
+	return res.Docs, res.Total, err
+}
+
+// SetTrackTotalHits sets how many hits searches count exactly: 0 for the elastic default of 10000, a negative number
+// to count all of them, at the cost of visiting every matching document
+func (i *Index) SetTrackTotalHits(limit int) {
+	i.trackTotalHits = limit
+}
+
+// SearchTimed searches like Search, also returning the time elastic reports spending on the search
+func (i *Index) SearchTimed(q query.Query) (index.SearchResponse, error) {
+	// the query is analyzed with the search analyzer of the body field
+	var eq elastic.Query = elastic.NewMatchQuery("body", q.Term).Operator("and") //Simple AND query
+	if q.Term[0] == '"' {
+		eq = elastic.NewMatchPhraseQuery("body", q.Term[1:len(q.Term)-1]).Slop(0) //Phrase Query
+	}
 	//eq := elastic.NewQueryStringQuery(q.Term)
 	//eq := elastic.NewMatchQuery("body", q.Term).Analyzer("whitespace").Operator("and")    //Simple AND query
         //eq := elastic.NewMatchPhraseQuery("body", q.Term).Analyzer("whitespace").Slop(0)      //Phrase Query
@@ -215,29 +218,27 @@ func (i *Index) Search(q query.Query) ([]index.Document, int, error) {
         //st_latency := time.Now()
 
 
-        if Flag_highlight == true {
-                res, err = i.conn.Search(i.name).Type("doc").
-                Query(eq).
-		Highlight(hl).
-		From(q.Paging.Offset).
-		Size(q.Paging.Num).
-		Do()
-        } else {
-                res, err = i.conn.Search(i.name).Type("doc").
-                Query(eq).
-		//Highlight(hl).
+	search := i.conn.Search(i.name).
+		Query(eq).
 		From(q.Paging.Offset).
-		Size(q.Paging.Num).
-                FetchSource(false).
-		Do()
-        }
+		Size(q.Paging.Num)
+	if i.trackTotalHits < 0 {
+		search = search.TrackTotalHits(true)
+	} else if i.trackTotalHits > 0 {
+		search = search.TrackTotalHits(i.trackTotalHits)
+	}
+	if highlight {
+		res, err = search.Highlight(hl).Do(context.Background())
+	} else {
+		res, err = search.FetchSource(false).Do(context.Background())
+	}
 
         //j, _ := json.MarshalIndent(&res, "", "   ")
         //fmt.Println(string(j))
         //fmt.Println("=======", res.Hits.TotalHits)
         //fmt.Println("======= took ", res.TookInMillis, " ms\n\n")
 	if err != nil {
-		return nil, 0, err
+		return index.SearchResponse{}, err
 	}
 
 	ret := make([]index.Document, 0, q.Paging.Num)
@@ -253,52 +254,171 @@ func (i *Index) Search(q query.Query) ([]index.Document, int, error) {
 
 	}
 
-	//return ret, int(res.TotalHits()), err
-	return ret, int(res.TookInMillis*10), err
+	// beyond the tracked limit, the total is a lower bound of the number of hits
+	return index.SearchResponse{
+		Docs:  ret,
+		Total: int(res.TotalHits()),
+		Took:  time.Duration(res.TookInMillis) * time.Millisecond,
+	}, nil
 }
 
-// Drop deletes the index
+// Drop deletes the index and its suggestions
 func (i *Index) Drop() error {
-	i.conn.DeleteIndex(i.name).Do()
+	// deleted one by one, since deleting several indices fails altogether when one of them is missing
+	i.conn.DeleteIndex(i.name).Do(context.Background())
+	i.conn.DeleteIndex(i.suggestIndex()).Do(context.Background())
 
 	return nil
 }
 
-// AddTerms add suggestion terms to the suggester index
+// autocompleteType names the suggestion index, after the index it belongs to, and its completion suggester
+const autocompleteType = "autocomplete"
+
+// suggestionDoc is the document storing a suggestion term, keyed by the term itself so it can be updated and deleted.
+// Completion fields only hold inputs and weights, so the payload is stored next to it
+type suggestionDoc struct {
+	Sugg struct {
+		Input  []string `json:"input"`
+		Weight int      `json:"weight"`
+	} `json:"sugg"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// suggestionWeightScale scales suggestion scores to the integer weights of completion fields, keeping three decimals
+// of fractional scores. Weights are 32 bit integers, so higher scores are capped at math.MaxInt32/suggestionWeightScale
+const suggestionWeightScale = 1000
+
+// suggestionWeight converts a suggestion score to a completion weight
+func suggestionWeight(score float64) int {
+	return int(math.Min(math.Max(math.Round(score*suggestionWeightScale), 0), math.MaxInt32))
+}
+
+// suggestionScore converts a completion weight back to a suggestion score
+func suggestionScore(weight float64) float64 {
+	return weight / suggestionWeightScale
+}
+
+func newSuggestionDoc(s index.Suggestion) suggestionDoc {
+	var d suggestionDoc
+	d.Sugg.Input = []string{s.Term}
+	d.Sugg.Weight = suggestionWeight(s.Score)
+	d.Payload = s.Payload
+	return d
+}
+
+// AddTerms add suggestion terms to the suggester index, replacing the score and payload of existing ones
 func (i *Index) AddTerms(terms ...index.Suggestion) error {
 	blk := i.conn.Bulk()
 
 	for _, term := range terms {
-		req := elastic.NewBulkIndexRequest().Index(i.name).Type("autocomplete").
-			Doc(map[string]interface{}{"sugg": term.Term})
+		req := elastic.NewBulkIndexRequest().Index(i.suggestIndex()).Id(term.Term).
+			Doc(newSuggestionDoc(term))
 
 		blk.Add(req)
 
 	}
-	_, err := blk.Refresh(true).Do()
+	_, err := blk.Refresh("true").Do(context.Background())
 
 	return err
 
 }
 
-// Suggest gets completion suggestions for a given prefix.
-// TODO: fuzzy not supported yet
+// IncrTerms adds suggestion terms to the suggester index, adding their score to that of existing ones.
+// Elastic can't increment a completion weight in place, so the current weights are read first and the terms
+// written back. This is not atomic, concurrent increments of the same term may be lost
+func (i *Index) IncrTerms(terms ...index.Suggestion) error {
+	mg := i.conn.MultiGet()
+	for _, term := range terms {
+		mg.Add(elastic.NewMultiGetItem().Index(i.suggestIndex()).Id(term.Term))
+	}
+	res, err := mg.Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	current := map[string]suggestionDoc{}
+	for _, d := range res.Docs {
+		if d == nil || !d.Found || d.Source == nil {
+			continue
+		}
+		var sd suggestionDoc
+		if err := json.Unmarshal(d.Source, &sd); err != nil {
+			return err
+		}
+		current[d.Id] = sd
+	}
+
+	incremented := make([]index.Suggestion, 0, len(terms))
+	for _, term := range terms {
+		if sd, found := current[term.Term]; found {
+			term.Score += suggestionScore(float64(sd.Sugg.Weight))
+			if term.Payload == "" {
+				term.Payload = sd.Payload
+			}
+		}
+		incremented = append(incremented, term)
+	}
+	return i.AddTerms(incremented...)
+}
+
+// DeleteTerms deletes suggestion terms from the suggester index, returning the number of terms that existed
+func (i *Index) DeleteTerms(terms ...string) (int, error) {
+	blk := i.conn.Bulk()
+	for _, term := range terms {
+		blk.Add(elastic.NewBulkDeleteRequest().Index(i.suggestIndex()).Id(term))
+	}
+	res, err := blk.Refresh("true").Do(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, item := range res.Deleted() {
+		if item.Status == http.StatusOK {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Len returns the number of terms in the suggester index
+func (i *Index) Len() (int, error) {
+	n, err := i.conn.Count(i.suggestIndex()).Do(context.Background())
+	return int(n), err
+}
+
+// Suggest gets completion suggestions for a given prefix. Fuzzy suggestions match prefixes up to the suggest distance
+// away from the given prefix
 func (i *Index) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
 
-	s := elastic.NewCompletionSuggester("autocomplete").Field("sugg").Text(prefix).Size(num)
+	s := elastic.NewCompletionSuggester(autocompleteType).Field("sugg").Size(num).SkipDuplicates(true)
+	if fuzzy {
+		// fuzziness applies from the first character, as it does on RediSearch
+		s = s.PrefixWithOptions(prefix,
+			elastic.NewFuzzyCompletionSuggesterOptions().EditDistance(i.suggestDistance).PrefixLength(0))
+	} else {
+		s = s.Prefix(prefix)
+	}
 
-	res, err := i.conn.Suggest(i.name).Suggester(s).Do()
+	// suggestions are requested along with an empty search
+	res, err := i.conn.Search(i.suggestIndex()).Suggester(s).Size(0).Do(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	if suggs, found := res["autocomplete"]; found {
+	if suggs, found := res.Suggest[autocompleteType]; found {
 		if len(suggs) > 0 {
 			opts := suggs[0].Options
 
 			ret := make([]index.Suggestion, 0, len(opts))
 			for _, op := range opts {
-				ret = append(ret, index.Suggestion{Term: op.Text, Score: float64(op.Score)})
+				sugg := index.Suggestion{Term: op.Text, Score: suggestionScore(op.ScoreUnderscore)}
+				// the payload is read from the suggestion document, returned with each suggestion
+				var sd suggestionDoc
+				if len(op.Source) > 0 && json.Unmarshal(op.Source, &sd) == nil {
+					sugg.Payload = sd.Payload
+				}
+				ret = append(ret, sugg)
 			}
 			return ret, nil
 		}
@@ -310,7 +430,8 @@ func (i *Index) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion,
 
 }
 
-// Delete the suggestion index, currently just calls Drop()
+// Delete deletes all the suggestions, recreating an empty suggestion index
 func (i *Index) Delete() error {
-	return i.Drop()
+	i.conn.DeleteIndex(i.suggestIndex()).Do(context.Background())
+	return i.createSuggestIndex()
 }
@@ -1,12 +1,15 @@
 package elastic
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
+	"github.com/olivere/elastic/v7"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,7 +19,7 @@ func TestIndex(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx, err := NewIndex("http://localhost:9200", "testung", "doc", md)
+	idx, err := NewIndex("http://localhost:9200", "testung", md)
 	assert.NoError(t, err)
 	assert.NoError(t, idx.Drop())
 	assert.NoError(t, idx.Create())
@@ -50,14 +53,14 @@ func TestSuggest(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx, err := NewIndex("http://localhost:9200", "testung", "doc", md)
+	idx, err := NewIndex("http://localhost:9200", "testung", md)
 	assert.NoError(t, err)
 	assert.NoError(t, idx.Drop())
 	assert.NoError(t, idx.Create())
 
 	suggs := []index.Suggestion{}
 	for i := 0; i < 100; i++ {
-		suggs = append(suggs, index.Suggestion{fmt.Sprintf("suggestion %d", i), float64(i)})
+		suggs = append(suggs, index.Suggestion{Term: fmt.Sprintf("suggestion %d", i), Score: float64(i)})
 	}
 
 	assert.NoError(t, idx.AddTerms(suggs...))
@@ -67,3 +70,104 @@ func TestSuggest(t *testing.T) {
 	fmt.Println(suggs)
 	assert.True(t, len(suggs) == 10)
 }
+
+func TestAutocompleter(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0))
+	ac, err := NewIndex("http://localhost:9200", "testung", md)
+	assert.NoError(t, err)
+	ac.Drop()
+	assert.NoError(t, ac.Create())
+
+	assert.NoError(t, ac.Delete())
+	assert.NoError(t, ac.AddTerms(
+		index.Suggestion{Term: "hello world", Score: 1},
+		index.Suggestion{Term: "hello", Score: 2},
+		index.Suggestion{Term: "jello world", Score: 3},
+	))
+
+	suggs, err := ac.Suggest("hel", 10, false)
+	assert.NoError(t, err)
+	assert.Len(t, suggs, 2)
+
+	suggs, err = ac.Suggest("hel", 10, true)
+	assert.NoError(t, err)
+	assert.Len(t, suggs, 3)
+
+	assert.NoError(t, ac.AddTerms(index.Suggestion{Term: "help", Score: 1, Payload: "doc1"}))
+	assert.NoError(t, ac.IncrTerms(index.Suggestion{Term: "help", Score: 9}))
+	suggs, err = ac.Suggest("help", 1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, suggs, 1) {
+		assert.Equal(t, "help", suggs[0].Term)
+	}
+
+	n, err := ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = ac.DeleteTerms("help", "nosuchterm")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestIndexOptions(t *testing.T) {
+	assert.Equal(t, DefaultIndexOptions, indexOptions(nil))
+
+	opts := indexOptions(IndexOptions{
+		Analyzers: map[string]Analyzer{"folded": {Tokenizer: "standard", Filters: []string{"lowercase", "asciifolding"}}},
+		Settings:  map[string]interface{}{"refresh_interval": "30s", "number_of_shards": 5},
+	})
+	assert.Equal(t, 1, opts.Shards)
+	assert.Equal(t, DefaultBulkOptions, opts.Bulk)
+
+	// unset bulk options are defaulted one by one
+	bulk := indexOptions(IndexOptions{Bulk: BulkOptions{Workers: 8}}).Bulk
+	assert.Equal(t, 8, bulk.Workers)
+	assert.Equal(t, DefaultBulkOptions.Actions, bulk.Actions)
+	assert.Equal(t, DefaultBulkOptions.Bytes, bulk.Bytes)
+	assert.Equal(t, map[string]interface{}{
+		"refresh_interval":   "30s",
+		"number_of_shards":   1,
+		"number_of_replicas": 0,
+		"analysis": map[string]interface{}{
+			"analyzer": map[string]interface{}{
+				"folded": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding"},
+				},
+			},
+			"filter": map[string]map[string]interface{}(nil),
+		},
+	}, opts.settings())
+}
+
+func TestBulkErrors(t *testing.T) {
+	var b bulkIndexer
+	reqs := []elastic.BulkableRequest{elastic.NewBulkIndexRequest(), elastic.NewBulkIndexRequest()}
+
+	b.after(1, reqs, &elastic.BulkResponse{Items: []map[string]*elastic.BulkResponseItem{
+		{"index": {Id: "doc1", Status: 201}},
+		{"index": {Id: "doc2", Status: 400, Error: &elastic.ErrorDetails{Type: "mapper_parsing_exception", Reason: "failed to parse"}}},
+	}}, nil)
+	b.after(2, reqs, nil, errors.New("connection refused"))
+
+	st := b.stats()
+	assert.EqualValues(t, 3, st.Failed)
+	assert.Equal(t, []BulkItemError{
+		{Id: "doc2", Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse"},
+		{Id: "bulk 2", Reason: "connection refused"},
+	}, st.Errors)
+	assert.Equal(t, "document doc2: 400 mapper_parsing_exception: failed to parse", st.Errors[0].Error())
+}
+
+func TestSuggestionWeight(t *testing.T) {
+	d := newSuggestionDoc(index.Suggestion{Term: "hello", Score: 0.25})
+	assert.Equal(t, 250, d.Sugg.Weight)
+	assert.Equal(t, 0.25, suggestionScore(float64(d.Sugg.Weight)))
+
+	assert.Equal(t, 0, suggestionWeight(-1))
+	assert.Equal(t, math.MaxInt32, suggestionWeight(1e10))
+}
@@ -0,0 +1,163 @@
+package elastic
+
+import "time"
+
+// Analyzer is a custom analyzer, built from a tokenizer, character filters and token filters
+type Analyzer struct {
+	Tokenizer   string
+	CharFilters []string
+	Filters     []string
+}
+
+// FieldAnalysis sets how a text field is analyzed at index and search time
+type FieldAnalysis struct {
+	// Analyzer and SearchAnalyzer are built-in or custom analyzer names, empty for the defaults
+	Analyzer       string
+	SearchAnalyzer string
+	// IndexOptions is what is indexed for each term, e.g. "offsets" for fast highlighting
+	IndexOptions string
+}
+
+// IndexOptions configure the settings and analysis of an elastic index. They are passed as the Options of the
+// index.Metadata given to NewIndex
+type IndexOptions struct {
+	Shards   int
+	Replicas int
+	// Analyzers are custom analyzers by name, Filters custom token filters by name, e.g.
+	// {"english_stop": {"type": "stop", "stopwords": "_english_"}}
+	Analyzers map[string]Analyzer
+	Filters   map[string]map[string]interface{}
+	// Fields sets the analysis of text fields by field name
+	Fields map[string]FieldAnalysis
+	// Settings are extra index settings, e.g. {"refresh_interval": "30s"}
+	Settings map[string]interface{}
+	// Bulk configures the bulk indexing of documents
+	Bulk BulkOptions
+}
+
+// BulkOptions configure the background bulk processor documents are indexed with. A bulk request is sent when it
+// holds Actions documents or Bytes bytes, or FlushInterval after its first document, whichever comes first. Zero fields
+// are set to those of DefaultBulkOptions
+type BulkOptions struct {
+	Actions       int
+	Bytes         int
+	FlushInterval time.Duration
+	// Workers is the number of bulk requests in flight. Indexing blocks while they are all busy
+	Workers int
+	// Documents rejected because the cluster is overloaded (429) are retried, waiting RetryBackoff before the first
+	// retry and doubling it for each further retry up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// DefaultBulkOptions send bulks of 1000 documents or 5MB at least every second, with 4 bulks in flight
+var DefaultBulkOptions = BulkOptions{
+	Actions:         1000,
+	Bytes:           5 << 20,
+	FlushInterval:   time.Second,
+	Workers:         4,
+	RetryBackoff:    100 * time.Millisecond,
+	MaxRetryBackoff: 30 * time.Second,
+}
+
+// withDefaults returns the options with their zero fields set to those of DefaultBulkOptions
+func (o BulkOptions) withDefaults() BulkOptions {
+	if o.Actions <= 0 {
+		o.Actions = DefaultBulkOptions.Actions
+	}
+	if o.Bytes <= 0 {
+		o.Bytes = DefaultBulkOptions.Bytes
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultBulkOptions.FlushInterval
+	}
+	if o.Workers <= 0 {
+		o.Workers = DefaultBulkOptions.Workers
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultBulkOptions.RetryBackoff
+	}
+	if o.MaxRetryBackoff <= 0 {
+		o.MaxRetryBackoff = DefaultBulkOptions.MaxRetryBackoff
+	}
+	return o
+}
+
+// DefaultIndexOptions index the body with an english analyzer and search it split on whitespace only, on a single
+// shard without replicas. The ICU plugin's "icu_folding" filter may be appended to the english analyzer's filters
+var DefaultIndexOptions = IndexOptions{
+	Shards:   1,
+	Replicas: 0,
+	Analyzers: map[string]Analyzer{
+		"my_english_analyzer": {
+			Tokenizer:   "standard",
+			CharFilters: []string{"html_strip"},
+			Filters: []string{"english_possessive_stemmer", "lowercase", "english_stop", "english_stemmer",
+				"asciifolding"},
+		},
+	},
+	Filters: map[string]map[string]interface{}{
+		"english_stop": {
+			"type":      "stop",
+			"stopwords": "_english_",
+		},
+		"english_possessive_stemmer": {
+			"type":     "stemmer",
+			"language": "possessive_english",
+		},
+		"english_stemmer": {
+			"type":     "stemmer",
+			"language": "english",
+		},
+	},
+	Fields: map[string]FieldAnalysis{
+		"body": {
+			Analyzer:       "my_english_analyzer",
+			SearchAnalyzer: "whitespace",
+			IndexOptions:   "offsets",
+		},
+	},
+	Bulk: DefaultBulkOptions,
+}
+
+// settings returns the index settings for the options
+func (o IndexOptions) settings() map[string]interface{} {
+	analyzers := make(map[string]interface{}, len(o.Analyzers))
+	for name, a := range o.Analyzers {
+		def := map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": a.Tokenizer,
+		}
+		if len(a.CharFilters) > 0 {
+			def["char_filter"] = a.CharFilters
+		}
+		if len(a.Filters) > 0 {
+			def["filter"] = a.Filters
+		}
+		analyzers[name] = def
+	}
+
+	settings := map[string]interface{}{}
+	for k, v := range o.Settings {
+		settings[k] = v
+	}
+	settings["number_of_shards"] = o.Shards
+	settings["number_of_replicas"] = o.Replicas
+	settings["analysis"] = map[string]interface{}{
+		"analyzer": analyzers,
+		"filter":   o.Filters,
+	}
+	return settings
+}
+
+// indexOptions returns the options in the metadata, or the default options
+func indexOptions(opts interface{}) IndexOptions {
+	if o, ok := opts.(IndexOptions); ok {
+		if o.Shards <= 0 {
+			o.Shards = 1
+		}
+		o.Bulk = o.Bulk.withDefaults()
+		return o
+	}
+	return DefaultIndexOptions
+}
@@ -1,6 +1,8 @@
 package index
 
 import (
+	"time"
+
 	"github.com/RedisLabs/RediSearchBenchmark/query"
 )
 
@@ -13,3 +15,18 @@ type Index interface {
         Drop() error
 	Create() error
 }
+
+// SearchResponse is the page of documents found by a search, along with the total number of documents matched and
+// the time the engine reports spending on the search
+type SearchResponse struct {
+	Docs  []Document
+	Total int
+	// Took is the server side time of the search, without the network round trip and the client's parsing
+	Took time.Duration
+}
+
+// TimedSearcher is implemented by indexes whose engine reports how long it took to run a search, so that it can be
+// told apart from the round trip time seen by the client
+type TimedSearcher interface {
+	SearchTimed(query.Query) (SearchResponse, error)
+}
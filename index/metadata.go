@@ -27,10 +27,24 @@ type Field struct {
 	Options interface{}
 }
 
-// TextFieldOptions Options for text fields - weight and stemming enabled/disabled.
+// TextFieldOptions Options for text fields - weight, stemming, sorting and phonetic matching.
 type TextFieldOptions struct {
 	Weight   float32
 	Stemming bool
+	Sortable bool
+	// Phonetic is the phonetic matcher used for the field (e.g. "dm:en"), or empty for none
+	Phonetic string
+}
+
+// NumericFieldOptions Options for numeric fields
+type NumericFieldOptions struct {
+	Sortable bool
+}
+
+// ValueFieldOptions Options for value fields - the separator splitting multiple values, and sorting
+type ValueFieldOptions struct {
+	Separator string
+	Sortable  bool
 }
 
 // NewTextField creates a new text field with the given weight
@@ -39,7 +53,7 @@ func NewTextField(name string, weight float32) Field {
 		Name: name,
 		Type: TextField,
 		Options: TextFieldOptions{
-			Weight:   1.0,
+			Weight:   weight,
 			Stemming: true,
 		},
 	}
@@ -53,6 +67,33 @@ func NewNumericField(name string) Field {
 	}
 }
 
+// NewGeoField creates a new geo field with the given name. Values are "lon,lat" strings or [2]float64 pairs
+func NewGeoField(name string) Field {
+	return Field{
+		Name: name,
+		Type: GeoField,
+	}
+}
+
+// NewValueField creates a new value field with the given name, with multiple values split by separator
+func NewValueField(name string, separator string) Field {
+	return Field{
+		Name: name,
+		Type: ValueField,
+		Options: ValueFieldOptions{
+			Separator: separator,
+		},
+	}
+}
+
+// NewNoIndexField creates a field that is stored with the document but not indexed
+func NewNoIndexField(name string) Field {
+	return Field{
+		Name: name,
+		Type: NoIndexField,
+	}
+}
+
 // Metadata represents an index schema metadata, or how the index would
 // treat documents sent to it.
 type Metadata struct {
@@ -0,0 +1,367 @@
+package redisearch
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Reducer is a single REDUCE clause of a GROUPBY step in an aggregation
+type Reducer struct {
+	Name  string
+	Args  []string
+	Alias string
+}
+
+// NewReducer creates a reducer calling the given reduce function with its arguments
+func NewReducer(name string, alias string, args ...string) Reducer {
+	return Reducer{
+		Name:  name,
+		Args:  args,
+		Alias: alias,
+	}
+}
+
+// ReduceCount counts the records in each group
+func ReduceCount(alias string) Reducer {
+	return NewReducer("COUNT", alias)
+}
+
+// ReduceCountDistinct counts the distinct values of a property in each group
+func ReduceCountDistinct(property, alias string) Reducer {
+	return NewReducer("COUNT_DISTINCT", alias, property)
+}
+
+// ReduceSum sums a numeric property in each group
+func ReduceSum(property, alias string) Reducer {
+	return NewReducer("SUM", alias, property)
+}
+
+// ReduceAvg averages a numeric property in each group
+func ReduceAvg(property, alias string) Reducer {
+	return NewReducer("AVG", alias, property)
+}
+
+// ReduceMin returns the minimal value of a numeric property in each group
+func ReduceMin(property, alias string) Reducer {
+	return NewReducer("MIN", alias, property)
+}
+
+// ReduceMax returns the maximal value of a numeric property in each group
+func ReduceMax(property, alias string) Reducer {
+	return NewReducer("MAX", alias, property)
+}
+
+// ReduceToList collects the distinct values of a property in each group into a list
+func ReduceToList(property, alias string) Reducer {
+	return NewReducer("TOLIST", alias, property)
+}
+
+func (r Reducer) args() redis.Args {
+	args := redis.Args{"REDUCE", r.Name, len(r.Args)}
+	for _, a := range r.Args {
+		args = append(args, a)
+	}
+	if r.Alias != "" {
+		args = append(args, "AS", r.Alias)
+	}
+	return args
+}
+
+// SortKey is a property an aggregation is sorted by, and its direction
+type SortKey struct {
+	Property  string
+	Ascending bool
+}
+
+// Aggregation is a typed builder of an FT.AGGREGATE request. Steps are executed in the order they were added
+type Aggregation struct {
+	Query string
+
+	verbatim    bool
+	load        []string
+	steps       []redis.Args
+	cursor      bool
+	cursorCount int
+	maxIdle     time.Duration
+}
+
+// NewAggregation creates a new aggregation over the documents matching the query
+func NewAggregation(query string) *Aggregation {
+	return &Aggregation{
+		Query: query,
+		steps: []redis.Args{},
+	}
+}
+
+// Verbatim disables stemming of the query terms
+func (a *Aggregation) Verbatim() *Aggregation {
+	a.verbatim = true
+	return a
+}
+
+// Load loads document properties that are not sortable into the pipeline
+func (a *Aggregation) Load(properties ...string) *Aggregation {
+	a.load = append(a.load, properties...)
+	return a
+}
+
+// GroupBy groups the pipeline records by the given properties, reducing each group with the reducers
+func (a *Aggregation) GroupBy(properties []string, reducers ...Reducer) *Aggregation {
+	step := redis.Args{"GROUPBY", len(properties)}
+	for _, p := range properties {
+		step = append(step, p)
+	}
+	for _, r := range reducers {
+		step = append(step, r.args()...)
+	}
+	a.steps = append(a.steps, step)
+	return a
+}
+
+// Apply evaluates an expression on each record, storing the result as alias
+func (a *Aggregation) Apply(expression, alias string) *Aggregation {
+	a.steps = append(a.steps, redis.Args{"APPLY", expression, "AS", alias})
+	return a
+}
+
+// SortBy sorts the pipeline by the given keys. If max is positive, only the top max records are kept
+func (a *Aggregation) SortBy(max int, keys ...SortKey) *Aggregation {
+	step := redis.Args{"SORTBY", len(keys) * 2}
+	for _, k := range keys {
+		dir := "DESC"
+		if k.Ascending {
+			dir = "ASC"
+		}
+		step = append(step, k.Property, dir)
+	}
+	if max > 0 {
+		step = append(step, "MAX", max)
+	}
+	a.steps = append(a.steps, step)
+	return a
+}
+
+// Filter removes records not matching the expression from the pipeline
+func (a *Aggregation) Filter(expression string) *Aggregation {
+	a.steps = append(a.steps, redis.Args{"FILTER", expression})
+	return a
+}
+
+// Limit pages the records of the pipeline
+func (a *Aggregation) Limit(offset, num int) *Aggregation {
+	a.steps = append(a.steps, redis.Args{"LIMIT", offset, num})
+	return a
+}
+
+// WithCursor makes the aggregation return its results in batches of count rows through a cursor.
+// Cursors idle for more than maxIdle are deleted by the server. A zero maxIdle uses the server default
+func (a *Aggregation) WithCursor(count int, maxIdle time.Duration) *Aggregation {
+	a.cursor = true
+	a.cursorCount = count
+	a.maxIdle = maxIdle
+	return a
+}
+
+// args serializes the aggregation to FT.AGGREGATE arguments for the given index name
+func (a *Aggregation) args(name string) redis.Args {
+	args := redis.Args{name, a.Query}
+	if a.verbatim {
+		args = append(args, "VERBATIM")
+	}
+	if len(a.load) > 0 {
+		args = append(args, "LOAD", len(a.load))
+		for _, p := range a.load {
+			args = append(args, p)
+		}
+	}
+	for _, step := range a.steps {
+		args = append(args, step...)
+	}
+	if a.cursor {
+		args = append(args, "WITHCURSOR")
+		if a.cursorCount > 0 {
+			args = append(args, "COUNT", a.cursorCount)
+		}
+		if a.maxIdle > 0 {
+			args = append(args, "MAXIDLE", int64(a.maxIdle/time.Millisecond))
+		}
+	}
+	return args
+}
+
+// ParseAggregation parses an aggregation from its command line form - the query followed by the
+// FT.AGGREGATE arguments, e.g. `* GROUPBY 1 @title REDUCE COUNT 0 AS num SORTBY 2 @num DESC`.
+// Arguments containing spaces should be double quoted
+func ParseAggregation(line string) (*Aggregation, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = ' '
+	r.LazyQuotes = true
+	fields, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	toks := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f != "" {
+			toks = append(toks, f)
+		}
+	}
+	if len(toks) == 0 {
+		return nil, errors.New("empty aggregation")
+	}
+
+	a := NewAggregation(toks[0])
+	step := redis.Args{}
+	inCursor := false
+	for n := 1; n < len(toks); n++ {
+		t := strings.ToUpper(toks[n])
+		switch {
+		case t == "WITHCURSOR":
+			a.cursor = true
+			inCursor = true
+		case inCursor && (t == "COUNT" || t == "MAXIDLE") && n+1 < len(toks):
+			v, err := strconv.Atoi(toks[n+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", t, toks[n+1])
+			}
+			if t == "COUNT" {
+				a.cursorCount = v
+			} else {
+				a.maxIdle = time.Duration(v) * time.Millisecond
+			}
+			n++
+		default:
+			inCursor = false
+			step = append(step, toks[n])
+		}
+	}
+	if len(step) > 0 {
+		a.steps = append(a.steps, step)
+	}
+	return a, nil
+}
+
+// AggregateRow is a single result row of an aggregation, mapping property names to values
+type AggregateRow map[string]interface{}
+
+// loadRows converts the rows of an FT.AGGREGATE or FT.CURSOR reply, returning the total as well
+func loadRows(res []interface{}) ([]AggregateRow, int, error) {
+	if len(res) == 0 {
+		return nil, 0, errors.New("empty aggregation reply")
+	}
+	total, err := redis.Int(res[0], nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows := make([]AggregateRow, 0, len(res)-1)
+	for _, r := range res[1:] {
+		lst, err := redis.Values(r, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		row := make(AggregateRow, len(lst)/2)
+		for n := 0; n+1 < len(lst); n += 2 {
+			k, err := redis.String(lst[n], nil)
+			if err != nil {
+				return nil, 0, err
+			}
+			switch v := lst[n+1].(type) {
+			case []byte:
+				row[k] = string(v)
+			default:
+				row[k] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, total, nil
+}
+
+// loadCursorReply converts a reply of an aggregation with a cursor, returning the rows and the next cursor id.
+// A cursor id of 0 means the results are exhausted
+func loadCursorReply(reply interface{}) ([]AggregateRow, int64, error) {
+	res, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(res) != 2 {
+		return nil, 0, fmt.Errorf("invalid cursor reply length %d", len(res))
+	}
+	page, err := redis.Values(res[0], nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, _, err := loadRows(page)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := redis.Int64(res[1], nil)
+	return rows, cursor, err
+}
+
+// Aggregate runs an aggregation on the index, returning its rows. For aggregations with a cursor,
+// only the first batch is returned, along with the cursor id to read the rest with CursorRead
+func (i *Index) Aggregate(a *Aggregation) (rows []AggregateRow, cursor int64, err error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	reply, err := conn.Do(i.commandPrefix+".AGGREGATE", a.args(i.name)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if a.cursor {
+		return loadCursorReply(reply)
+	}
+
+	res, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, _, err = loadRows(res)
+	return rows, 0, err
+}
+
+// CursorRead reads the next batch of rows from an aggregation cursor. If count is 0 the batch size
+// given to WithCursor is used
+func (i *Index) CursorRead(cursor int64, count int) ([]AggregateRow, int64, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	args := redis.Args{"READ", i.name, cursor}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	reply, err := conn.Do(i.commandPrefix+".CURSOR", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return loadCursorReply(reply)
+}
+
+// CursorDelete deletes an aggregation cursor before it is exhausted
+func (i *Index) CursorDelete(cursor int64) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do(i.commandPrefix+".CURSOR", "DEL", i.name, cursor)
+	return err
+}
+
+// AggregateAll runs an aggregation and reads all its rows, draining the cursor if it has one
+func (i *Index) AggregateAll(a *Aggregation) ([]AggregateRow, error) {
+	rows, cursor, err := i.Aggregate(a)
+	for err == nil && cursor != 0 {
+		var batch []AggregateRow
+		batch, cursor, err = i.CursorRead(cursor, 0)
+		rows = append(rows, batch...)
+	}
+	return rows, err
+}
@@ -9,16 +9,15 @@ import (
 
 // Autocompleter implements a redisearch auto-completer API
 type Autocompleter struct {
-	pool *redis.Pool
+	pool connPool
 	name string
 }
 
-// NewAutocompleter creates a new Autocompleter with the given host and key name
-func NewAutocompleter(addr, name string) *Autocompleter {
+// NewAutocompleter creates a new Autocompleter with the given host and key name.
+// If conn is nil, the default connection options are used
+func NewAutocompleter(addr, name string, conn *ConnectionOptions) *Autocompleter {
 	return &Autocompleter{
-		pool: redis.NewPool(func() (redis.Conn, error) {
-			return redis.Dial("tcp", addr)
-		}, maxConns),
+		pool: newPool(addr, conn),
 		name: name,
 	}
 }
@@ -33,15 +32,32 @@ func (a *Autocompleter) Delete() error {
 	return err
 }
 
-// AddTerms pushes new term suggestions to the index
+// AddTerms pushes new term suggestions to the index, replacing the score and payload of existing ones
 func (a *Autocompleter) AddTerms(terms ...index.Suggestion) error {
+	return a.addTerms(false, terms)
+}
+
+// IncrTerms pushes term suggestions to the index, incrementing the score of existing ones
+func (a *Autocompleter) IncrTerms(terms ...index.Suggestion) error {
+	return a.addTerms(true, terms)
+}
+
+// addTerms pipelines FT.SUGADD commands for the terms, incrementing their scores if incr is set
+func (a *Autocompleter) addTerms(incr bool, terms []index.Suggestion) error {
 
 	conn := a.pool.Get()
 	defer conn.Close()
 
 	i := 0
 	for _, term := range terms {
-		if err := conn.Send("FT.SUGADD", a.name, term.Term, term.Score); err != nil {
+		args := redis.Args{a.name, term.Term, term.Score}
+		if incr {
+			args = append(args, "INCR")
+		}
+		if term.Payload != "" {
+			args = append(args, "PAYLOAD", term.Payload)
+		}
+		if err := conn.Send("FT.SUGADD", args...); err != nil {
 			return err
 		}
 		i++
@@ -58,14 +74,48 @@ func (a *Autocompleter) AddTerms(terms ...index.Suggestion) error {
 	return nil
 }
 
+// DeleteTerms deletes suggestions from the index, returning the number of suggestions that existed
+func (a *Autocompleter) DeleteTerms(terms ...string) (int, error) {
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	for _, term := range terms {
+		if err := conn.Send("FT.SUGDEL", a.name, term); err != nil {
+			return 0, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for range terms {
+		n, err := redis.Int(conn.Receive())
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// Len returns the number of suggestions in the index
+func (a *Autocompleter) Len() (int, error) {
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	return redis.Int(conn.Do("FT.SUGLEN", a.name))
+}
+
 // Suggest gets completion suggestions from the Autocompleter dictionary to the given prefix.
 // If fuzzy is set, we also complete for prefixes that are in 1 Levenshten distance from the
-// given prefix
+// given prefix. Suggestions are returned with their payloads
 func (a *Autocompleter) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
 	conn := a.pool.Get()
 	defer conn.Close()
 
-	args := redis.Args{a.name, prefix, "MAX", num, "WITHSCORES"}
+	args := redis.Args{a.name, prefix, "MAX", num, "WITHSCORES", "WITHPAYLOADS"}
 	if fuzzy {
 		args = append(args, "FUZZY")
 	}
@@ -74,14 +124,15 @@ func (a *Autocompleter) Suggest(prefix string, num int, fuzzy bool) ([]index.Sug
 		return nil, err
 	}
 
-	ret := make([]index.Suggestion, 0, len(vals)/2)
-	for i := 0; i < len(vals); i += 2 {
+	// each suggestion is a triplet of term, score and payload
+	ret := make([]index.Suggestion, 0, len(vals)/3)
+	for i := 0; i+2 < len(vals); i += 3 {
 
 		score, err := strconv.ParseFloat(vals[i+1], 64)
 		if err != nil {
 			continue
 		}
-		ret = append(ret, index.Suggestion{Term: vals[i], Score: score})
+		ret = append(ret, index.Suggestion{Term: vals[i], Score: score, Payload: vals[i+2]})
 
 	}
 
@@ -0,0 +1,375 @@
+package redisearch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/garyburd/redigo/redis"
+)
+
+// numSlots is the number of hash slots in a Redis Cluster
+const numSlots = 16384
+
+// maxRedirects is the number of MOVED/ASK redirections we follow for a single command
+const maxRedirects = 5
+
+// minRefreshInterval limits how often MOVED replies trigger a topology refresh
+const minRefreshInterval = time.Second
+
+// crc16 computes the CRC16-CCITT (XMODEM) checksum Redis Cluster uses for key slots
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// keySlot returns the cluster slot of a key, hashing only its hash tag if it has one
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16([]byte(key)) % numSlots)
+}
+
+// clusterTopology maps the slots of a Redis Cluster to the nodes owning them, and holds a connection pool per node
+type clusterTopology struct {
+	mtx         sync.RWMutex
+	seeds       []string
+	conn        *ConnectionOptions
+	slots       [numSlots]string
+	pools       map[string]*redis.Pool
+	lastRefresh time.Time
+}
+
+// newClusterTopology discovers the topology of the cluster from the first seed node that answers
+func newClusterTopology(seeds []string, conn *ConnectionOptions) (*clusterTopology, error) {
+	t := &clusterTopology{
+		seeds: seeds,
+		conn:  conn,
+		pools: map[string]*redis.Pool{},
+	}
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// slotRange is a range of slots owned by a single master node
+type slotRange struct {
+	start, end int
+	addr       string
+}
+
+// clusterShards reads the slot ranges of the cluster with CLUSTER SHARDS, available since Redis 7
+func clusterShards(c redis.Conn, seed string) ([]slotRange, error) {
+	shards, err := redis.Values(c.Do("CLUSTER", "SHARDS"))
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterShards(shards, seed)
+}
+
+// nodeProps converts the properties of a node of a CLUSTER SHARDS reply to strings. Their values are strings, except
+// for numbers such as the port and the replication offset
+func nodeProps(node interface{}) (map[string]string, error) {
+	fields, err := redis.Values(node, nil)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(fields)/2)
+	for n := 0; n+1 < len(fields); n += 2 {
+		name, err := redis.String(fields[n], nil)
+		if err != nil {
+			return nil, err
+		}
+		switch v := fields[n+1].(type) {
+		case []byte:
+			props[name] = string(v)
+		case string:
+			props[name] = v
+		case int64:
+			props[name] = strconv.FormatInt(v, 10)
+		}
+	}
+	return props, nil
+}
+
+// parseClusterShards reads the slot ranges of the shards of a CLUSTER SHARDS reply. It fails if no slot range is owned
+// by an online master, so that the caller falls back to CLUSTER SLOTS
+func parseClusterShards(shards []interface{}, seed string) ([]slotRange, error) {
+	ret := []slotRange{}
+	for _, sh := range shards {
+		fields, err := redis.Values(sh, nil)
+		if err != nil {
+			return nil, err
+		}
+		var slots []int
+		var addr string
+		for n := 0; n+1 < len(fields); n += 2 {
+			name, _ := redis.String(fields[n], nil)
+			switch name {
+			case "slots":
+				if slots, err = redis.Ints(fields[n+1], nil); err != nil {
+					return nil, err
+				}
+			case "nodes":
+				nodes, err := redis.Values(fields[n+1], nil)
+				if err != nil {
+					return nil, err
+				}
+				for _, node := range nodes {
+					props, err := nodeProps(node)
+					if err != nil {
+						return nil, err
+					}
+					if props["role"] == "master" && props["health"] == "online" {
+						host := props["ip"]
+						if host == "" {
+							host = props["endpoint"]
+						}
+						port := props["port"]
+						if port == "" {
+							port = props["tls-port"]
+						}
+						addr = nodeAddr(host, port, seed)
+					}
+				}
+			}
+		}
+		if addr == "" {
+			continue
+		}
+		for n := 0; n+1 < len(slots); n += 2 {
+			ret = append(ret, slotRange{slots[n], slots[n+1], addr})
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no slot ranges in CLUSTER SHARDS reply")
+	}
+	return ret, nil
+}
+
+// clusterSlots reads the slot ranges of the cluster with CLUSTER SLOTS, for servers before Redis 7
+func clusterSlots(c redis.Conn, seed string) ([]slotRange, error) {
+	res, err := redis.Values(c.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]slotRange, 0, len(res))
+	for _, r := range res {
+		// each range is of the form [start, end, [master host, master port, ...], replicas...]
+		rng, err := redis.Values(r, nil)
+		if err != nil || len(rng) < 3 {
+			return nil, fmt.Errorf("invalid CLUSTER SLOTS reply %v", r)
+		}
+		start, _ := redis.Int(rng[0], nil)
+		end, _ := redis.Int(rng[1], nil)
+		master, err := redis.Values(rng[2], nil)
+		if err != nil || len(master) < 2 {
+			return nil, fmt.Errorf("invalid CLUSTER SLOTS node %v", rng[2])
+		}
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		ret = append(ret, slotRange{start, end, nodeAddr(host, strconv.Itoa(port), seed)})
+	}
+	return ret, nil
+}
+
+// nodeAddr builds a node address, using the seed host for nodes that don't announce their host
+func nodeAddr(host, port, seed string) string {
+	if host == "" || host == "?" {
+		host, _, _ = net.SplitHostPort(seed)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// refresh reloads the slot map from the seed nodes, trying CLUSTER SHARDS before CLUSTER SLOTS
+func (t *clusterTopology) refresh() error {
+	var err error
+	for _, seed := range t.seeds {
+		c := t.pool(seed).Get()
+		var ranges []slotRange
+		if ranges, err = clusterShards(c, seed); err != nil {
+			ranges, err = clusterSlots(c, seed)
+		}
+		c.Close()
+		if err != nil {
+			continue
+		}
+
+		t.mtx.Lock()
+		for _, r := range ranges {
+			for s := r.start; s <= r.end && s < numSlots; s++ {
+				t.slots[s] = r.addr
+			}
+		}
+		t.lastRefresh = time.Now()
+		t.mtx.Unlock()
+		return nil
+	}
+	if err == nil {
+		err = errors.New("no cluster seed nodes given")
+	}
+	return err
+}
+
+// refreshAfterMove refreshes the topology after a MOVED reply, unless it was refreshed very recently
+func (t *clusterTopology) refreshAfterMove() {
+	t.mtx.RLock()
+	recent := time.Since(t.lastRefresh) < minRefreshInterval
+	t.mtx.RUnlock()
+	if !recent {
+		t.refresh()
+	}
+}
+
+// addrFor returns the address of the node owning a slot
+func (t *clusterTopology) addrFor(slot int) string {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return t.slots[slot]
+}
+
+// pool returns the connection pool of a node, creating it on first use
+func (t *clusterTopology) pool(addr string) *redis.Pool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	p, found := t.pools[addr]
+	if !found {
+		p = newPool(addr, t.conn)
+		t.pools[addr] = p
+	}
+	return p
+}
+
+// slotPool returns a connection pool routing connections to whichever node currently owns the slot
+func (t *clusterTopology) slotPool(slot int) connPool {
+	return slotPool{t, slot}
+}
+
+// newIndex creates an index living on the node owning the slot of its name
+func (t *clusterTopology) newIndex(name string, md *index.Metadata) *Index {
+	return newIndex(t.slotPool(keySlot(name)), name, md)
+}
+
+// newAutocompleter creates an autocompleter living on the node owning the slot of its key
+func (t *clusterTopology) newAutocompleter(name string) *Autocompleter {
+	return &Autocompleter{
+		pool: t.slotPool(keySlot(name)),
+		name: name,
+	}
+}
+
+// slotPool is a connPool of connections to the node owning a slot, following redirections
+type slotPool struct {
+	t    *clusterTopology
+	slot int
+}
+
+// Get gets a connection to the current owner of the slot
+func (p slotPool) Get() redis.Conn {
+	return &clusterConn{
+		Conn: p.t.pool(p.t.addrFor(p.slot)).Get(),
+		t:    p.t,
+	}
+}
+
+// command is a command sent on a clusterConn, kept until its reply is received so it can be redirected
+type command struct {
+	name string
+	args []interface{}
+}
+
+// clusterConn is a connection to a cluster node, which follows MOVED and ASK redirections
+// by resending commands to the node they were redirected to
+type clusterConn struct {
+	redis.Conn
+	t       *clusterTopology
+	pending []command
+}
+
+// parseRedirect parses a MOVED or ASK error, returning the redirection kind and the target address
+func parseRedirect(err error) (kind string, addr string, ok bool) {
+	rerr, isRedis := err.(redis.Error)
+	if !isRedis {
+		return "", "", false
+	}
+	parts := strings.Fields(string(rerr))
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// redirect runs a command that was redirected, following further redirections
+func (c *clusterConn) redirect(cmd command, reply interface{}, err error) (interface{}, error) {
+	for n := 0; n < maxRedirects; n++ {
+		kind, addr, ok := parseRedirect(err)
+		if !ok {
+			return reply, err
+		}
+		if kind == "MOVED" {
+			c.t.refreshAfterMove()
+		}
+
+		conn := c.t.pool(addr).Get()
+		if kind == "ASK" {
+			if _, err := conn.Do("ASKING"); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		reply, err = conn.Do(cmd.name, cmd.args...)
+		conn.Close()
+	}
+	return reply, err
+}
+
+// Do sends a command and waits for its reply, following redirections
+func (c *clusterConn) Do(name string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(name, args...)
+	// Do also receives the replies of all pipelined commands
+	c.pending = nil
+	if name == "" {
+		return reply, err
+	}
+	return c.redirect(command{name, args}, reply, err)
+}
+
+// Send pipelines a command, remembering it in case it is redirected
+func (c *clusterConn) Send(name string, args ...interface{}) error {
+	if err := c.Conn.Send(name, args...); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, command{name, args})
+	return nil
+}
+
+// Receive receives the reply of the oldest pipelined command, following redirections
+func (c *clusterConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	if len(c.pending) == 0 {
+		return reply, err
+	}
+	cmd := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.redirect(cmd, reply, err)
+}
@@ -0,0 +1,150 @@
+package redisearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ConnectionOptions configure how we connect to redis, and the connection pool of each index
+type ConnectionOptions struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	// Username is the ACL user to authenticate as. If empty and Password is set, we authenticate as the default user
+	Username string
+	Password string
+
+	// TLS enables TLS connections, verified with the CA file if given. CertFile and KeyFile are the client certificate
+	TLS                bool
+	CACertFile         string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// DB is the database number to select on connect
+	DB int
+
+	// MaxActive is the maximal number of connections per host, 0 for unlimited
+	MaxActive int
+	MaxIdle   int
+	// IdleTimeout closes connections idle for longer than this, 0 to keep them forever
+	IdleTimeout time.Duration
+	// HealthCheck pings connections idle for longer than this when they are taken from the pool, 0 to disable
+	HealthCheck time.Duration
+}
+
+// connPool is a source of redis connections. It is implemented by redis.Pool, and by cluster slot
+// pools that route connections to the node owning a slot
+type connPool interface {
+	Get() redis.Conn
+}
+
+// DefaultConnectionOptions are the connection options used when none are given
+func DefaultConnectionOptions() ConnectionOptions {
+	return ConnectionOptions{
+		MaxIdle: 500,
+	}
+}
+
+// tlsConfig loads the TLS configuration of the options, with the CA and client certificate files
+func (o ConnectionOptions) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+
+	if o.CACertFile != "" {
+		pem, err := ioutil.ReadFile(o.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + o.CACertFile)
+		}
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// newPool creates a connection pool to the redis server at addr. If opts is nil the default options are used
+func newPool(addr string, opts *ConnectionOptions) *redis.Pool {
+	o := DefaultConnectionOptions()
+	if opts != nil {
+		o = *opts
+	}
+
+	dialOpts := []redis.DialOption{
+		redis.DialConnectTimeout(o.ConnectTimeout),
+		redis.DialReadTimeout(o.ReadTimeout),
+		redis.DialWriteTimeout(o.WriteTimeout),
+	}
+	// with an ACL user we authenticate ourselves after connecting, since DialPassword only sends the password. The
+	// database is then selected after AUTH too, as a server requiring authentication rejects SELECT before it
+	if o.Username == "" {
+		dialOpts = append(dialOpts, redis.DialDatabase(o.DB))
+		if o.Password != "" {
+			dialOpts = append(dialOpts, redis.DialPassword(o.Password))
+		}
+	}
+
+	var tlsErr error
+	if o.TLS {
+		var cfg *tls.Config
+		if cfg, tlsErr = o.tlsConfig(); tlsErr == nil {
+			dialOpts = append(dialOpts, redis.DialUseTLS(true), redis.DialTLSConfig(cfg),
+				redis.DialTLSSkipVerify(o.InsecureSkipVerify))
+		}
+	}
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			if tlsErr != nil {
+				return nil, tlsErr
+			}
+			conn, err := redis.Dial("tcp", addr, dialOpts...)
+			if err != nil {
+				return nil, err
+			}
+			if o.Username != "" {
+				if _, err := conn.Do("AUTH", o.Username, o.Password); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				if o.DB != 0 {
+					if _, err := conn.Do("SELECT", o.DB); err != nil {
+						conn.Close()
+						return nil, err
+					}
+				}
+			}
+			return conn, nil
+		},
+		MaxActive:   o.MaxActive,
+		MaxIdle:     o.MaxIdle,
+		IdleTimeout: o.IdleTimeout,
+		// wait for a free connection instead of failing when MaxActive is reached
+		Wait: o.MaxActive > 0,
+	}
+
+	if o.HealthCheck > 0 {
+		pool.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < o.HealthCheck {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		}
+	}
+	return pool
+}
@@ -1,8 +1,11 @@
 package redisearch
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"hash/crc32"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,45 +16,237 @@ import (
 // DistributedIndex is a redisearch index aggregator, working on several redisearch indexes at once,
 // and reducing their result to one unified result.
 type DistributedIndex struct {
+	// hedgeStats is updated atomically, and is kept first for 64 bit alignment
+	hedgeStats HedgeStats
+
+	// mtx guards the partition layout, which changes when resharding
+	mtx        sync.RWMutex
 	partitions []index.Index
-	completers []index.Autocompleter
 	part       Partitioner
 	timeout    time.Duration
-	wq         workQueue
+
+	// completers and suggestPart are the autocompleters and partitioner of suggestions. They are kept as created
+	// when resharding, since suggestions can't be read back to be migrated
+	completers  []index.Autocompleter
+	suggestPart Partitioner
+	exec       *executor
+
+	// policy decides whether searches fail or return partial results when partitions fail or time out
+	policy ShardFailurePolicy
+
+	// hedging and retry settings of shard requests, and the recent shard latencies the hedging delay is based on
+	hedgePercentile float64
+	hedgeMinDelay   time.Duration
+	retries         int
+	retryBackoff    time.Duration
+	latencies       *latencyTracker
+
+	// globalScoring rescores results with the term statistics of all partitions
+	globalScoring bool
+
+	// prefixRouting is the length of the term prefix suggestions are partitioned by, 0 to partition them by term
+	prefixRouting int
+
+	// newPartition creates the sub-index and autocompleter of a replica of a partition
+	newPartition partitionFactory
+	replicas     ReplicaOptions
+	// migrating is set while resharding, when documents may be found on both their old and new partitions
+	migrating bool
 }
 
-// NewDistributedIndex creates a distributed index on the given redis hosts, creating sub indexes per the given number of partitions
-func NewDistributedIndex(name string, hosts []string, partitions int, md *index.Metadata) *DistributedIndex {
+// partitionFactory creates the sub-index and autocompleter of a replica of the n-th partition of a distributed index,
+// whose partitions have the given number of replicas each
+type partitionFactory func(n, replica, replicas int) (index.Index, index.Autocompleter)
 
-	part := ModuloPartitioner{partitions}
+// ShardFailurePolicy decides what a distributed search returns when some of the partitions fail or time out
+type ShardFailurePolicy int
+
+const (
+	// FailOnShardError fails the search if any partition failed or timed out
+	FailOnShardError ShardFailurePolicy = iota
+
+	// BestEffort returns the merged results of the partitions that answered, with a *PartialResultError
+	// listing the partitions that didn't. The search only fails if no partition answered
+	BestEffort
+)
+
+// ErrShardTimeout is the error of a partition that didn't answer before the search timeout
+var ErrShardTimeout = errors.New("shard timed out")
+
+// ShardError is the failure of a single partition in a distributed search
+type ShardError struct {
+	Partition int
+	Err       error
+}
+
+// ShardInfo is the outcome of the search of a single partition, for debugging slow searches
+type ShardInfo struct {
+	Partition int
+	// Latency is the time the partition took to answer, or the time we waited for it if it timed out
+	Latency time.Duration
+	// Results is the number of documents the partition returned, and Total the number it matched
+	Results int
+	Total   int
+	// Took is the server side time of the search, when profiled
+	Took time.Duration
+	Err  error
+}
 
-	subs := make([]index.Index, 0, partitions)
-	completers := make([]index.Autocompleter, 0, partitions)
+// PartialResultError is returned by searches in BestEffort mode along with the results of the partitions that
+// answered, when some partitions failed or timed out
+type PartialResultError struct {
+	Failed []ShardError
+}
 
-	for i := 0; i < partitions; i++ {
-		addr := hosts[i%len(hosts)]
-		subs = append(subs, NewIndex(addr, fmt.Sprintf("%s{%d}", name, i), md))
-		completers = append(completers, NewAutocompleter(addr, fmt.Sprintf("%s.autocomplete{%d}", name, i)))
+func (e *PartialResultError) Error() string {
+	parts := make([]string, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		parts = append(parts, fmt.Sprintf("partition %d: %s", f.Partition, f.Err))
 	}
+	return "partial results, " + strings.Join(parts, ", ")
+}
 
-	wq := newWorkQueue(partitions * 50)
+// DistributedOption is an optional setting of a DistributedIndex, given to its constructor
+type DistributedOption func(*DistributedIndex)
+
+// WithPartitioner sets the partitioner placing documents and suggestions on partitions. It must partition
+// keys to the same number of partitions as the index, or the index fails to be created. The default is a
+// ModuloPartitioner
+func WithPartitioner(p Partitioner) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.part = p
+	}
+}
 
-	return &DistributedIndex{
-		part:       part,
-		partitions: subs,
-		completers: completers,
-		timeout:    100 * time.Millisecond,
-		wq:         wq,
+// WithTimeout sets the deadline for all partitions to answer a search. Partitions that don't answer in time are
+// handled according to the shard failure policy. A zero timeout, the default, waits for all partitions
+func WithTimeout(timeout time.Duration) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.timeout = timeout
 	}
+}
 
+// WithShardFailurePolicy sets what searches return when partitions fail or time out. The default is FailOnShardError
+func WithShardFailurePolicy(policy ShardFailurePolicy) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.policy = policy
+	}
+}
+
+// NewDistributedIndex creates a distributed index on the given redis hosts, creating sub indexes per the given number of partitions.
+// With WithReplicas, each partition is placed on its own group of consecutive hosts, replica r of partition n being on
+// host n*replicas+r. There should be partitions*replicas hosts, fewer hosts are used round robin so that groups overlap.
+// If conn is nil, the default connection options are used
+func NewDistributedIndex(name string, hosts []string, partitions int, md *index.Metadata, conn *ConnectionOptions,
+	opts ...DistributedOption) (*DistributedIndex, error) {
+
+	idx := newDistributedIndex(partitions, func(n, replica, replicas int) (index.Index, index.Autocompleter) {
+		addr := hosts[(n*replicas+replica)%len(hosts)]
+		return NewIndex(addr, fmt.Sprintf("%s{%d}", name, n), md, conn),
+			NewAutocompleter(addr, fmt.Sprintf("%s.autocomplete{%d}", name, n), conn)
+	}, opts)
+	if err := checkPartitioner(idx.part, partitions); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// NewClusterIndex creates a distributed index on a Redis Cluster, discovering its topology from the given seed nodes.
+// Each partition is placed on the node owning the slot of its hash tag, and requests follow the cluster's redirections
+// when slots are migrated. If conn is nil, the default connection options are used
+func NewClusterIndex(name string, seeds []string, partitions int, md *index.Metadata, conn *ConnectionOptions,
+	opts ...DistributedOption) (*DistributedIndex, error) {
+
+	topology, err := newClusterTopology(seeds, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newDistributedIndex(partitions, func(n, replica, replicas int) (index.Index, index.Autocompleter) {
+		return topology.newIndex(fmt.Sprintf("%s{%d}", name, n), md),
+			topology.newAutocompleter(fmt.Sprintf("%s.autocomplete{%d}", name, n))
+	}, opts)
+	if idx.replicas.Replicas > 1 {
+		idx.Close()
+		return nil, errors.New("replicas are not supported on a Redis Cluster")
+	}
+	if err := checkPartitioner(idx.part, partitions); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// newDistributedIndex creates a distributed index with the given number of partitions, created by newPartition
+func newDistributedIndex(partitions int, newPartition partitionFactory, opts []DistributedOption) *DistributedIndex {
+
+	part := ModuloPartitioner{partitions}
+
+	ret := &DistributedIndex{
+		part:         part,
+		policy:       FailOnShardError,
+		latencies:    &latencyTracker{},
+		exec:         newExecutor(partitions * 50),
+		newPartition: newPartition,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	ret.suggestPart = ret.part
+	ret.partitions = make([]index.Index, 0, partitions)
+	ret.completers = make([]index.Autocompleter, 0, partitions)
+	for n := 0; n < partitions; n++ {
+		sub, ac := ret.buildPartition(n)
+		ret.partitions = append(ret.partitions, sub)
+		ret.completers = append(ret.completers, ac)
+	}
+	return ret
+}
+
+// buildPartition creates the sub-index and autocompleter of the n-th partition, over all its replicas
+func (i *DistributedIndex) buildPartition(n int) (index.Index, index.Autocompleter) {
+	if i.replicas.Replicas <= 1 {
+		return i.newPartition(n, 0, 1)
+	}
+
+	set := newReplicaSet(i.replicas)
+	sub := &replicatedIndex{replicaSet: set}
+	ac := &replicatedCompleter{replicaSet: set}
+	for r := 0; r < i.replicas.Replicas; r++ {
+		s, a := i.newPartition(n, r, i.replicas.Replicas)
+		sub.replicas = append(sub.replicas, s)
+		ac.replicas = append(ac.replicas, a)
+	}
+	return sub, ac
 }
 
 func (i *DistributedIndex) Refresh() error {
         return nil
 }
+
+// Close stops the workers running the shard requests of the index. The index can't be searched afterwards
+func (i *DistributedIndex) Close() {
+	i.exec.Shutdown()
+}
+
+// ExecutorStats returns the queueing metrics of the shard requests of the index
+func (i *DistributedIndex) ExecutorStats() ExecutorStats {
+	return i.exec.Stats()
+}
+
+// layout returns the current partitions and partitioner, and whether a resharding is in progress
+func (i *DistributedIndex) layout() ([]index.Index, Partitioner, bool) {
+	i.mtx.RLock()
+	defer i.mtx.RUnlock()
+	return i.partitions, i.part, i.migrating
+}
+
 // Create calls the FT.CREATE command based on the metadata on all sub-indexes
 func (i *DistributedIndex) Create() error {
-	for _, s := range i.partitions {
+	partitions, _, _ := i.layout()
+	for _, s := range partitions {
 		if err := s.Create(); err != nil {
 			return err
 		}
@@ -61,7 +256,8 @@ func (i *DistributedIndex) Create() error {
 
 // Drop deletes all data from the index on all sub-indexes
 func (i *DistributedIndex) Drop() error {
-	for _, s := range i.partitions {
+	partitions, _, _ := i.layout()
+	for _, s := range partitions {
 		if err := s.Drop(); err != nil {
 			return err
 		}
@@ -73,26 +269,31 @@ func (i *DistributedIndex) Drop() error {
 // sub-lists based on the partitions, and then pushes them in parallel to all sub-indexes
 func (i *DistributedIndex) Index(docs []index.Document, options interface{}) error {
 
-	splitDocs := make([][]index.Document, len(i.partitions))
+	partitions, part, _ := i.layout()
+	splitDocs := make([][]index.Document, len(partitions))
 	for _, d := range docs {
 
-		splitDocs[i.part.PartitionFor(d.Id)] = append(splitDocs[i.part.PartitionFor(d.Id)], d)
+		p := partitionForDocument(part, d)
+		splitDocs[p] = append(splitDocs[p], d)
 
 	}
 
-	var err error
+	errs := make([]error, len(splitDocs))
 	var wg sync.WaitGroup
 	for x, split := range splitDocs {
 		wg.Add(1)
 		go func(x int, split []index.Document) {
-			if e := i.partitions[x].Index(split, options); err != nil {
-				err = e
-			}
+			errs[x] = partitions[x].Index(split, options)
 			wg.Done()
 		}(x, split)
 	}
 	wg.Wait()
-	return err
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 
 }
 
@@ -100,26 +301,53 @@ func (i *DistributedIndex) Index(docs []index.Document, options interface{}) err
 type searchResult struct {
 	docs  []index.Document
 	total int
-	err   error
+	// terms are the term statistics of the partition, with global scoring
+	terms *partitionTerms
+	// latency is the time it took to search the partition, and took the server side time of the search when profiled
+	latency time.Duration
+	took    time.Duration
 }
 
-// mergeResults merges the results from all partitions into one result based on score
-func (i *DistributedIndex) mergeResults(rs []interface{}, offset, num int) ([]index.Document, int) {
+// searchTimed searches an index with SearchTimed if it reports the server side time of searches, and with Search
+// otherwise
+func searchTimed(idx index.Index, q query.Query) (index.SearchResponse, error) {
+	if ts, ok := idx.(index.TimedSearcher); ok {
+		return ts.SearchTimed(q)
+	}
+	docs, total, err := idx.Search(q)
+	return index.SearchResponse{Docs: docs, Total: total}, err
+}
+
+// mergeResults merges the results from all partitions into one result based on score. If dedup is set,
+// documents found on more than one partition are only returned once
+func (i *DistributedIndex) mergeResults(rs []taskResult[searchResult], offset, num int, dedup bool) ([]index.Document, int) {
 
 	ret := make([]index.Document, 0, num)
 	total := 0
-	for _, v := range rs {
-		r, ok := v.(searchResult)
-		if !ok {
+	for _, r := range rs {
+		if r.Err != nil {
 			continue
 		}
 
-		ret = append(ret, r.docs...)
-		total += r.total
+		ret = append(ret, r.Value.docs...)
+		total += r.Value.total
 	}
 
 	index.DocumentList(ret).Sort()
 
+	if dedup {
+		seen := make(map[string]bool, len(ret))
+		unique := ret[:0]
+		for _, d := range ret {
+			if !seen[d.Id] {
+				seen[d.Id] = true
+				unique = append(unique, d)
+			}
+		}
+		total -= len(ret) - len(unique)
+		ret = unique
+	}
+
 	if len(ret) < offset {
 		ret = []index.Document{}
 	} else {
@@ -135,128 +363,369 @@ func (i *DistributedIndex) mergeResults(rs []interface{}, offset, num int) ([]in
 
 // Search searches the sub-indexes in parallel for the given query, and reduces their results into one result
 func (i *DistributedIndex) Search(q query.Query) (docs []index.Document, total int, err error) {
+	docs, total, _, err = i.SearchDebug(q)
+	return docs, total, err
+}
 
-	tg := i.wq.NewTaskGroup()
+// SearchDebug searches like Search, also returning the latency, number of results and error of each partition.
+// The partition infos are returned even if the search failed
+func (i *DistributedIndex) SearchDebug(q query.Query) (docs []index.Document, total int, shards []ShardInfo, err error) {
+	return i.search(q, false)
+}
+
+// SearchTimed searches like Search, profiling the search on every partition. The server side time of the search is
+// that of the slowest partition, since they are searched in parallel
+func (i *DistributedIndex) SearchTimed(q query.Query) (index.SearchResponse, error) {
+	docs, total, shards, err := i.search(q, true)
+	res := index.SearchResponse{Docs: docs, Total: total}
+	for _, s := range shards {
+		if s.Err == nil && s.Took > res.Took {
+			res.Took = s.Took
+		}
+	}
+	return res, err
+}
+
+// search searches all the partitions and merges their results, profiling the partition searches if asked to
+func (i *DistributedIndex) search(q query.Query, profile bool) (docs []index.Document, total int, shards []ShardInfo, err error) {
+	start := time.Now()
+
+	ctx := context.Background()
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+
+	partitions, _, migrating := i.layout()
+	tg := newTaskGroup[searchResult](ctx, i.exec, len(partitions))
 
 	// the paging offset must be 0 when we send it to the servers or we won't be able to correctly merge
 	offset := q.Paging.Offset
 	q.Paging.Offset = 0
 
-	for n := 0; n < len(i.partitions); n++ {
-		tg.Submit(
-			func(v interface{}) interface{} {
-				sub := v.(index.Index)
-				res, total, err := sub.Search(q)
-				return searchResult{res, total, err}
-			},
-			i.partitions[n])
+	var terms []string
+	if i.globalScoring {
+		terms = queryTerms(q.Term)
+		q.Paging.Num *= globalScoringOverfetch
 	}
 
-	results, err := tg.Wait(i.timeout)
+	for n := 0; n < len(partitions); n++ {
+		n := n
+		err := tg.Submit(n, func(ctx context.Context) (searchResult, error) {
+			st := time.Now()
+			res, err := i.searchPartition(ctx, partitions[n], q, profile)
+			if err == nil && i.globalScoring {
+				res.terms, err = loadPartitionTerms(partitions[n], terms, res.docs)
+			}
+			res.latency = time.Since(st)
+			return res, err
+		})
+		if err == errShutdown {
+			return nil, 0, nil, err
+		} else if err != nil {
+			// timed out waiting for a worker, the partitions not sent are reported as timed out
+			break
+		}
+	}
 
-	docs, total = i.mergeResults(results, offset, q.Paging.Num)
+	// on timeout we go on with the results we have, the missing partitions are reported as failed
+	results, _ := tg.Wait()
 
-	return docs, total, err
+	shards = shardInfos(results, len(partitions), time.Since(start))
+	failed := shardFailures(shards)
+	if len(failed) > 0 && (i.policy == FailOnShardError || len(failed) == len(partitions)) {
+		f := failed[0]
+		return nil, 0, shards, fmt.Errorf("partition %d failed: %s", f.Partition, f.Err)
+	}
+
+	if i.globalScoring {
+		rescore(results, terms)
+		q.Paging.Num /= globalScoringOverfetch
+	}
+
+	// while resharding, documents being migrated may be found on both their old and new partitions
+	docs, total = i.mergeResults(results, offset, q.Paging.Num, migrating)
+
+	if len(failed) > 0 {
+		err = &PartialResultError{Failed: failed}
+	}
+	return docs, total, shards, err
 
 }
 
-// Partitioner is the interface that generates partition keys for index keys
-type Partitioner interface {
-	PartitionFor(id string) uint32
+// shardInfos reports the outcome of the search of each partition. Partitions that didn't return a result
+// are reported as timed out after the given elapsed time
+func shardInfos(results []taskResult[searchResult], partitions int, elapsed time.Duration) []ShardInfo {
+	shards := make([]ShardInfo, partitions)
+	for n := range shards {
+		shards[n] = ShardInfo{Partition: n, Latency: elapsed, Err: ErrShardTimeout}
+	}
+	for _, r := range results {
+		shards[r.Id] = ShardInfo{
+			Partition: r.Id,
+			Latency:   r.Value.latency,
+			Results:   len(r.Value.docs),
+			Total:     r.Value.total,
+			Took:      r.Value.took,
+			Err:       r.Err,
+		}
+	}
+	return shards
 }
 
-// ModuloPartitioner partitions keys based on simple static modulo based hashing function (using crc32)
-type ModuloPartitioner struct {
-	n int
+// shardFailures lists the partitions whose search failed or timed out
+func shardFailures(shards []ShardInfo) []ShardError {
+	failed := []ShardError{}
+	for _, s := range shards {
+		if s.Err != nil {
+			failed = append(failed, ShardError{s.Partition, s.Err})
+		}
+	}
+	return failed
 }
 
-// PartitionFor returns a partition number of a given key
-func (m ModuloPartitioner) PartitionFor(id string) uint32 {
-	return crc32.ChecksumIEEE([]byte(id)) % uint32(m.n)
+// WithPrefixRouting places suggestions on the partition of the first n characters of their term, so that suggestions
+// for prefixes of at least n characters are answered by a single partition. Fuzzy suggestions and shorter prefixes
+// are still sent to all partitions. Suggestions must have been added with the same routing, and keep the partition
+// they were added to when resharding
+func WithPrefixRouting(n int) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.prefixRouting = n
+	}
 }
 
-// AddTerms adds suggestion terms to the autocompleter index
-func (i *DistributedIndex) AddTerms(terms ...index.Suggestion) error {
-	splits := make([][]index.Suggestion, len(i.completers))
+// routePrefix returns the partition holding all the suggestions starting with prefix when routing by prefix,
+// and false if they may be on any partition
+func (i *DistributedIndex) routePrefix(part Partitioner, prefix string) (uint32, bool) {
+	if i.prefixRouting <= 0 {
+		return 0, false
+	}
+	// suggestions are case insensitive
+	r := []rune(strings.ToLower(prefix))
+	if len(r) < i.prefixRouting {
+		return 0, false
+	}
+	return part.PartitionFor(string(r[:i.prefixRouting])), true
+}
+
+// termPartition returns the partition a suggestion term is placed on
+func (i *DistributedIndex) termPartition(part Partitioner, term string) uint32 {
+	if p, ok := i.routePrefix(part, term); ok {
+		return p
+	}
+	return part.PartitionFor(term)
+}
+
+// splitTerms splits suggestion terms by the partition they are placed on
+func (i *DistributedIndex) splitTerms(completers []index.Autocompleter, part Partitioner,
+	terms []index.Suggestion) [][]index.Suggestion {
+
+	splits := make([][]index.Suggestion, len(completers))
 	for _, t := range terms {
-		p := i.part.PartitionFor(t.Term)
+		p := i.termPartition(part, t.Term)
 		splits[p] = append(splits[p], t)
 	}
+	return splits
+}
 
-	var err error
+// eachCompleter runs f on the autocompleters of the given partitions in parallel, returning the first error
+func eachCompleter(completers []index.Autocompleter, partitions []int, f func(n int, ac index.Autocompleter) error) error {
+	errs := make([]error, len(partitions))
 	var wg sync.WaitGroup
-	for x, split := range splits {
+	for x, n := range partitions {
 		wg.Add(1)
-		go func(x int, split []index.Suggestion) {
-			if e := i.completers[x].AddTerms(split...); err != nil {
-				err = e
-			}
+		go func(x, n int) {
+			errs[x] = f(n, completers[n])
 			wg.Done()
-		}(x, split)
+		}(x, n)
 	}
 	wg.Wait()
-	return err
+	for x, err := range errs {
+		if err != nil {
+			return fmt.Errorf("partition %d failed: %s", partitions[x], err)
+		}
+	}
+	return nil
+}
 
+// addTerms adds or increments suggestion terms on the partitions they are placed on
+func (i *DistributedIndex) addTerms(incr bool, terms []index.Suggestion) error {
+	completers, part := i.completers, i.suggestPart
+	splits := i.splitTerms(completers, part, terms)
+
+	targets := []int{}
+	for n, split := range splits {
+		if len(split) > 0 {
+			targets = append(targets, n)
+		}
+	}
+	return eachCompleter(completers, targets, func(n int, ac index.Autocompleter) error {
+		if incr {
+			return ac.IncrTerms(splits[n]...)
+		}
+		return ac.AddTerms(splits[n]...)
+	})
 }
 
-// Suggest gets suggestions from the autocompleter on all sub-indexes and merges them into one result
-func (i *DistributedIndex) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
+// AddTerms adds suggestion terms to the autocompleter index
+func (i *DistributedIndex) AddTerms(terms ...index.Suggestion) error {
+	return i.addTerms(false, terms)
+}
 
-	tg := i.wq.NewTaskGroup()
+// IncrTerms adds suggestion terms to the autocompleter index, incrementing the score of existing ones
+func (i *DistributedIndex) IncrTerms(terms ...index.Suggestion) error {
+	return i.addTerms(true, terms)
+}
 
-	for n := 0; n < len(i.completers); n++ {
-		tg.Submit(
-			func(v interface{}) interface{} {
-				sub := v.(index.Autocompleter)
-				results, err := sub.Suggest(prefix, num, fuzzy)
-				if err != nil {
-					return err
-				}
-				return results
-			},
-			i.completers[n])
+// DeleteTerms deletes suggestion terms from the partitions they are placed on, returning the number deleted
+func (i *DistributedIndex) DeleteTerms(terms ...string) (int, error) {
+	completers, part := i.completers, i.suggestPart
+	splits := make([][]string, len(completers))
+	targets := []int{}
+	for _, t := range terms {
+		p := i.termPartition(part, t)
+		if len(splits[p]) == 0 {
+			targets = append(targets, int(p))
+		}
+		splits[p] = append(splits[p], t)
 	}
 
-	results, err := tg.Wait(i.timeout)
-	if err != nil {
-		return nil, err
+	counts := make([]int, len(completers))
+	err := eachCompleter(completers, targets, func(n int, ac index.Autocompleter) (err error) {
+		counts[n], err = ac.DeleteTerms(splits[n]...)
+		return err
+	})
+	deleted := 0
+	for _, c := range counts {
+		deleted += c
 	}
-	return i.mergeSuggestions(results, num)
+	return deleted, err
+}
 
+// Len returns the number of suggestions over all partitions
+func (i *DistributedIndex) Len() (int, error) {
+	completers := i.completers
+	targets := make([]int, len(completers))
+	for n := range targets {
+		targets[n] = n
+	}
+
+	counts := make([]int, len(completers))
+	err := eachCompleter(completers, targets, func(n int, ac index.Autocompleter) (err error) {
+		counts[n], err = ac.Len()
+		return err
+	})
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	return total, err
 }
 
-func (i *DistributedIndex) mergeSuggestions(rs []interface{}, num int) ([]index.Suggestion, error) {
+// Suggest gets suggestions from the autocompleter on all sub-indexes and merges them into one result. With prefix
+// routing, only the partition holding the prefix is asked. Partitions that fail or time out are handled according to
+// the shard failure policy, like in searches
+func (i *DistributedIndex) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
 
-	ret := make([]index.Suggestion, 0, num)
-	var err error
-	for _, v := range rs {
-		switch x := v.(type) {
-		case error:
-			err = x
-		case []index.Suggestion:
-			ret = append(ret, x...)
-		default:
-			panic("Invalid type for AC suggestion!")
+	ctx := context.Background()
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+
+	completers, part := i.completers, i.suggestPart
+	targets := make([]int, 0, len(completers))
+	if p, ok := i.routePrefix(part, prefix); ok && !fuzzy {
+		targets = append(targets, int(p))
+	} else {
+		for n := range completers {
+			targets = append(targets, n)
 		}
 	}
 
-	if len(ret) == 0 {
-		return nil, err
+	tg := newTaskGroup[[]index.Suggestion](ctx, i.exec, len(targets))
+	for _, n := range targets {
+		n := n
+		err := tg.Submit(n, func(context.Context) ([]index.Suggestion, error) {
+			return completers[n].Suggest(prefix, num, fuzzy)
+		})
+		if err == errShutdown {
+			return nil, err
+		} else if err != nil {
+			break
+		}
 	}
 
-	index.SuggestionList(ret).Sort()
+	// on timeout we go on with the suggestions we have, the missing partitions are reported as failed
+	results, _ := tg.Wait()
 
-	if num > len(ret) {
-		num = len(ret)
+	answered := map[int]bool{}
+	failed := []ShardError{}
+	for _, r := range results {
+		answered[r.Id] = true
+		if r.Err != nil {
+			failed = append(failed, ShardError{r.Id, r.Err})
+		}
+	}
+	for _, n := range targets {
+		if !answered[n] {
+			failed = append(failed, ShardError{n, ErrShardTimeout})
+		}
+	}
+	if len(failed) > 0 && (i.policy == FailOnShardError || len(failed) == len(targets)) {
+		f := failed[0]
+		return nil, fmt.Errorf("partition %d failed: %s", f.Partition, f.Err)
+	}
+
+	ret := mergeSuggestions(results, num)
+	if len(failed) > 0 {
+		return ret, &PartialResultError{Failed: failed}
 	}
+	return ret, nil
+
+}
 
-	return ret[:num], nil
+// mergeSuggestions merges the suggestions of the partitions that answered into the top num suggestions. A term
+// returned by several partitions is kept once with its highest score, and suggestions with the same score are
+// ordered by term so that the merge doesn't depend on the order the partitions answered in
+func mergeSuggestions(rs []taskResult[[]index.Suggestion], num int) []index.Suggestion {
+
+	best := map[string]index.Suggestion{}
+	for _, r := range rs {
+		if r.Err != nil {
+			continue
+		}
+		for _, s := range r.Value {
+			if cur, found := best[s.Term]; !found || s.Score > cur.Score {
+				best[s.Term] = s
+			}
+		}
+	}
+
+	ret := make([]index.Suggestion, 0, len(best))
+	for _, s := range best {
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(a, b int) bool {
+		if ret[a].Score != ret[b].Score {
+			return ret[a].Score > ret[b].Score
+		}
+		return ret[a].Term < ret[b].Term
+	})
+
+	if num < len(ret) {
+		ret = ret[:num]
+	}
+	return ret
 }
 
 // Delete deletes the autocomplete keys on all sub-indexes
 func (i *DistributedIndex) Delete() error {
 
-	for _, c := range i.completers {
+	completers := i.completers
+	for _, c := range completers {
 		if err := c.Delete(); err != nil {
 			return err
 		}
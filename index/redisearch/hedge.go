@@ -0,0 +1,205 @@
+package redisearch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/RedisLabs/RediSearchBenchmark/query"
+	"github.com/garyburd/redigo/redis"
+)
+
+// latencyWindow is the number of recent shard latencies the hedging delay is computed from
+const latencyWindow = 1024
+
+// minHedgeSamples is the number of shard latencies we need before we start hedging
+const minHedgeSamples = 100
+
+// HedgeStats counts the hedged and retried shard requests of a distributed index
+type HedgeStats struct {
+	// HedgesSent is the number of duplicate requests sent to slow shards, HedgesWon the number that answered first
+	HedgesSent uint64
+	HedgesWon  uint64
+	// Retries is the number of shard requests resent after a transient error
+	Retries uint64
+}
+
+// WithHedging enables hedged shard requests. When a shard hasn't answered after the given percentile of recent shard
+// latencies (e.g. 0.95), but no sooner than minDelay, a duplicate request is sent and the first reply is used.
+// Hedging starts once enough latencies were recorded
+func WithHedging(percentile float64, minDelay time.Duration) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.hedgePercentile = percentile
+		i.hedgeMinDelay = minDelay
+	}
+}
+
+// WithRetries retries shard requests failing with transient connection errors up to max times,
+// waiting backoff before the first retry and doubling it for each further retry
+func WithRetries(max int, backoff time.Duration) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.retries = max
+		i.retryBackoff = backoff
+	}
+}
+
+// HedgeStats returns the number of hedged and retried shard requests so far
+func (i *DistributedIndex) HedgeStats() HedgeStats {
+	return HedgeStats{
+		HedgesSent: atomic.LoadUint64(&i.hedgeStats.HedgesSent),
+		HedgesWon:  atomic.LoadUint64(&i.hedgeStats.HedgesWon),
+		Retries:    atomic.LoadUint64(&i.hedgeStats.Retries),
+	}
+}
+
+// latencyTracker keeps a window of recent latencies, to compute their percentiles
+type latencyTracker struct {
+	mtx     sync.Mutex
+	samples [latencyWindow]time.Duration
+	num     int
+	next    int
+}
+
+// add records a latency, replacing the oldest one when the window is full
+func (t *latencyTracker) add(d time.Duration) {
+	t.mtx.Lock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencyWindow
+	if t.num < latencyWindow {
+		t.num++
+	}
+	t.mtx.Unlock()
+}
+
+// percentile returns the given percentile of the recorded latencies, and false if there are too few of them
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mtx.Lock()
+	if t.num < minHedgeSamples {
+		t.mtx.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, t.num)
+	copy(sorted, t.samples[:t.num])
+	t.mtx.Unlock()
+
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	n := int(p * float64(len(sorted)))
+	if n >= len(sorted) {
+		n = len(sorted) - 1
+	}
+	return sorted[n], true
+}
+
+// isTransient tells whether a shard request failed because of the connection or a temporarily unavailable server,
+// and may succeed if retried
+func isTransient(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == redis.ErrPoolExhausted {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if rerr, ok := err.(redis.Error); ok {
+		for _, prefix := range []string{"LOADING", "TRYAGAIN", "CLUSTERDOWN"} {
+			if strings.HasPrefix(string(rerr), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchWithRetries searches a single shard, retrying transient errors until the context is done
+func (i *DistributedIndex) searchWithRetries(ctx context.Context, sub index.Index, q query.Query, profile bool) (searchResult, error) {
+	for attempt := 0; ; attempt++ {
+		st := time.Now()
+		var res index.SearchResponse
+		var err error
+		if profile {
+			res, err = searchTimed(sub, q)
+		} else {
+			res.Docs, res.Total, err = sub.Search(q)
+		}
+		if err == nil {
+			i.latencies.add(time.Since(st))
+			return searchResult{docs: res.Docs, total: res.Total, took: res.Took}, nil
+		}
+		if attempt >= i.retries || !isTransient(err) {
+			return searchResult{}, err
+		}
+		atomic.AddUint64(&i.hedgeStats.Retries, 1)
+
+		timer := time.NewTimer(i.retryBackoff << uint(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return searchResult{}, ctx.Err()
+		}
+	}
+}
+
+// hedgeReply is the reply of a shard request, telling whether it came from the hedged request
+type hedgeReply struct {
+	res   searchResult
+	err   error
+	hedge bool
+}
+
+// searchPartition searches a single partition. If hedging is enabled and the partition is slower than usual, the
+// request is sent again, to another replica if the partition is replicated, and the first successful reply is returned
+func (i *DistributedIndex) searchPartition(ctx context.Context, sub index.Index, q query.Query, profile bool) (searchResult, error) {
+	if i.hedgePercentile <= 0 {
+		return i.searchWithRetries(ctx, sub, q, profile)
+	}
+	delay, ok := i.latencies.percentile(i.hedgePercentile)
+	if !ok {
+		return i.searchWithRetries(ctx, sub, q, profile)
+	}
+	if delay < i.hedgeMinDelay {
+		delay = i.hedgeMinDelay
+	}
+
+	// the channel holds both replies, so the losing request doesn't block once we returned
+	replies := make(chan hedgeReply, 2)
+	attempt := func(hedge bool) {
+		res, err := i.searchWithRetries(ctx, sub, q, profile)
+		replies <- hedgeReply{res, err, hedge}
+	}
+	go attempt(false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	outstanding := 1
+	for {
+		select {
+		case <-timer.C:
+			atomic.AddUint64(&i.hedgeStats.HedgesSent, 1)
+			outstanding++
+			go attempt(true)
+		case r := <-replies:
+			outstanding--
+			if r.err != nil && outstanding > 0 {
+				// wait for the other request
+				continue
+			}
+			if r.hedge && r.err == nil {
+				atomic.AddUint64(&i.hedgeStats.HedgesWon, 1)
+			}
+			return r.res, r.err
+		case <-ctx.Done():
+			return searchResult{}, ctx.Err()
+		}
+	}
+}
@@ -1,15 +1,38 @@
 package redisearch
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
 	"github.com/garyburd/redigo/redis"
 )
 
+// IndexingMode selects how documents are written to redis and indexed
+type IndexingMode int
+
+const (
+	// LegacyMode adds documents with FT.ADD, for RediSearch versions before 2.0
+	LegacyMode IndexingMode = iota
+
+	// HashMode writes documents as redis hashes with HSET, indexed by an ON HASH PREFIX index
+	HashMode
+
+	// JSONMode writes documents as JSON with JSON.SET, indexed by an ON JSON PREFIX index
+	JSONMode
+)
+
+// scoreField is the hash/JSON field holding the document score in HashMode and JSONMode
+const scoreField = "__score"
+
+// languageField is the hash/JSON field holding the document language in HashMode and JSONMode
+const languageField = "__language"
+
 // IndexingOptions are flags passed to the the abstract Index call, which receives them as interface{}, allowing
 // for implementation specific options
 type IndexingOptions struct {
@@ -28,44 +51,60 @@ type IndexingOptions struct {
 	NoOffsetVectors bool
 
 	Prefix string
+
+	// Mode selects how documents are stored and indexed. It is read from the Metadata options only
+	Mode IndexingMode
+
+	// KeyPrefix is the key prefix of documents in HashMode and JSONMode. Defaults to "<index name>:"
+	KeyPrefix string
+
+	// JSONPaths maps field names to their JSONPath in JSONMode. Defaults to "$.<field name>"
+	JSONPaths map[string]string
 }
 
 // Index is an interface to redisearch's redis connads
 type Index struct {
-	pool *redis.Pool
+	pool connPool
 
 	md            *index.Metadata
 	name          string
 	commandPrefix string
+	mode          IndexingMode
+	keyPrefix     string
+	jsonPaths     map[string]string
 }
 
-var maxConns = 500
+// NewIndex creates a new index connecting to the redis host, and using the given name as key prefix.
+// If conn is nil, the default connection options are used
+func NewIndex(addr, name string, md *index.Metadata, conn *ConnectionOptions) *Index {
+	return newIndex(newPool(addr, conn), name, md)
+}
 
-// NewIndex creates a new index connecting to the redis host, and using the given name as key prefix
-func NewIndex(addr, name string, md *index.Metadata) *Index {
+// newIndex creates a new index getting its connections from the given pool
+func newIndex(pool connPool, name string, md *index.Metadata) *Index {
 
 	ret := &Index{
 
-		pool: redis.NewPool(func() (redis.Conn, error) {
-			// TODO: Add timeouts. and 2 separate pools for indexing and querying, with different timeouts
-			return redis.Dial("tcp", addr)
-		}, maxConns),
-		md: md,
+		pool: pool,
+		md:   md,
 
 		name: name,
 
 		commandPrefix: "FT",
+		keyPrefix:     name + ":",
 	}
 	if md != nil && md.Options != nil {
 		if opts, ok := md.Options.(IndexingOptions); ok {
 			if opts.Prefix != "" {
 				ret.commandPrefix = md.Options.(IndexingOptions).Prefix
 			}
+			ret.mode = opts.Mode
+			if opts.KeyPrefix != "" {
+				ret.keyPrefix = opts.KeyPrefix
+			}
+			ret.jsonPaths = opts.JSONPaths
 		}
 	}
-	ret.pool.TestOnBorrow = nil
-	//ret.pool.MaxActive = ret.pool.MaxIdle
-
 	return ret
 
 }
@@ -77,10 +116,37 @@ func (i *Index) Refresh() error {
 // Create configues the index and creates it on redis
 func (i *Index) Create() error {
 
-	args := redis.Args{i.name, "SCHEMA"}
+	args := redis.Args{i.name}
+
+	switch i.mode {
+	case HashMode:
+		args = append(args, "ON", "HASH", "PREFIX", 1, i.keyPrefix)
+	case JSONMode:
+		args = append(args, "ON", "JSON", "PREFIX", 1, i.keyPrefix)
+	}
+
+	// index-wide options are taken from the metadata
+	if opts, ok := i.md.Options.(IndexingOptions); ok {
+		if opts.NoOffsetVectors {
+			args = append(args, "NOOFFSETS")
+		}
+		if opts.NoFieldFlags {
+			args = append(args, "NOFIELDS")
+		}
+		// score indexes were removed along with FT.ADD
+		if opts.NoScoreIndexes && i.mode == LegacyMode {
+			args = append(args, "NOSCOREIDX")
+		}
+	}
+
+	args = append(args, "SCHEMA")
 
 	for _, f := range i.md.Fields {
 
+		if f.Type != index.NoIndexField {
+			args = append(args, i.schemaName(f)...)
+		}
+
 		switch f.Type {
 		case index.TextField:
 
@@ -88,12 +154,37 @@ func (i *Index) Create() error {
 			if !ok {
 				return errors.New("Invalid text field options type")
 			}
-			args = append(args, f.Name, "TEXT", "WEIGHT", opts.Weight)
-
-			// stemming per field not supported yet
+			args = append(args, "TEXT")
+			if !opts.Stemming {
+				args = append(args, "NOSTEM")
+			}
+			args = append(args, "WEIGHT", opts.Weight)
+			if opts.Phonetic != "" {
+				args = append(args, "PHONETIC", opts.Phonetic)
+			}
+			if opts.Sortable {
+				args = append(args, "SORTABLE")
+			}
 
 		case index.NumericField:
-			args = append(args, f.Name, "NUMERIC")
+			args = append(args, "NUMERIC")
+			if opts, ok := f.Options.(index.NumericFieldOptions); ok && opts.Sortable {
+				args = append(args, "SORTABLE")
+			}
+
+		case index.GeoField:
+			args = append(args, "GEO")
+
+		case index.ValueField:
+			args = append(args, "TAG")
+			if opts, ok := f.Options.(index.ValueFieldOptions); ok {
+				if opts.Separator != "" {
+					args = append(args, "SEPARATOR", opts.Separator)
+				}
+				if opts.Sortable {
+					args = append(args, "SORTABLE")
+				}
+			}
 
 		case index.NoIndexField:
 			continue
@@ -111,6 +202,43 @@ func (i *Index) Create() error {
 	return err
 }
 
+// schemaName returns the field identifier used in the schema. In JSONMode this is the field's JSONPath
+// aliased to the field name
+func (i *Index) schemaName(f index.Field) redis.Args {
+	if i.mode != JSONMode {
+		return redis.Args{f.Name}
+	}
+	path, ok := i.jsonPaths[f.Name]
+	if !ok {
+		path = "$." + f.Name
+	}
+	return redis.Args{path, "AS", f.Name}
+}
+
+// fieldValue converts a document property to the value redisearch expects for the field's type
+func fieldValue(f index.Field, v interface{}) interface{} {
+	switch f.Type {
+	case index.GeoField:
+		switch p := v.(type) {
+		case [2]float64:
+			return fmt.Sprintf("%f,%f", p[0], p[1])
+		case []float64:
+			if len(p) == 2 {
+				return fmt.Sprintf("%f,%f", p[0], p[1])
+			}
+		}
+	case index.ValueField:
+		if vals, ok := v.([]string); ok {
+			sep := ","
+			if opts, ok := f.Options.(index.ValueFieldOptions); ok && opts.Separator != "" {
+				sep = opts.Separator
+			}
+			return strings.Join(vals, sep)
+		}
+	}
+	return v
+}
+
 // Index indexes multiple documents on the index, with optional IndexingOptions passed to options
 func (i *Index) Index(docs []index.Document, options interface{}) error {
 
@@ -128,6 +256,14 @@ func (i *Index) Index(docs []index.Document, options interface{}) error {
 	n := 0
 
 	for _, doc := range docs {
+		if i.mode != LegacyMode {
+			if err := i.sendDocument(conn, doc, opts); err != nil {
+				return err
+			}
+			n++
+			continue
+		}
+
 		args := make(redis.Args, 0, len(i.md.Fields)*2+4)
 		args = append(args, i.name, doc.Id, doc.Score)
 		// apply options
@@ -142,10 +278,9 @@ func (i *Index) Index(docs []index.Document, options interface{}) error {
 
 		args = append(args, "FIELDS")
 
-		for k, f := range doc.Properties {
-			if k == "body" {
-				//fmt.Println(k)
-				args = append(args, k, f)
+		for _, f := range i.md.Fields {
+			if v, found := doc.Properties[f.Name]; found {
+				args = append(args, f.Name, fieldValue(f, v))
 			}
 		}
 
@@ -169,6 +304,42 @@ func (i *Index) Index(docs []index.Document, options interface{}) error {
 	return nil
 }
 
+// sendDocument pipelines a document write as a hash or JSON key, for HashMode and JSONMode.
+// The index picks the key up by its prefix
+func (i *Index) sendDocument(conn redis.Conn, doc index.Document, opts IndexingOptions) error {
+	key := i.keyPrefix + doc.Id
+
+	if i.mode == JSONMode {
+		obj := make(map[string]interface{}, len(i.md.Fields)+2)
+		for _, f := range i.md.Fields {
+			if v, found := doc.Properties[f.Name]; found {
+				obj[f.Name] = fieldValue(f, v)
+			}
+		}
+		obj[scoreField] = doc.Score
+		if opts.Language != "" {
+			obj[languageField] = opts.Language
+		}
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		return conn.Send("JSON.SET", key, "$", b)
+	}
+
+	args := make(redis.Args, 0, len(i.md.Fields)*2+5)
+	args = append(args, key, scoreField, doc.Score)
+	if opts.Language != "" {
+		args = append(args, languageField, opts.Language)
+	}
+	for _, f := range i.md.Fields {
+		if v, found := doc.Properties[f.Name]; found {
+			args = append(args, f.Name, fieldValue(f, v))
+		}
+	}
+	return conn.Send("HSET", args...)
+}
+
 // convert the result from a redis query to a proper Document object
 func loadDocument(id, sc, fields interface{}) (index.Document, error) {
 
@@ -197,14 +368,48 @@ func loadDocument(id, sc, fields interface{}) (index.Document, error) {
 // Search searches the index for the given query, and returns documents,
 // the total number of results, or an error if something went wrong
 func (i *Index) Search(q query.Query) (docs []index.Document, total int, err error) {
-        Flag_highlight := true
-
         conn := i.pool.Get()
 	defer conn.Close()
-        //query_content := "\""+q.Term + "\"" //Phrase
-        query_content := q.Term  // AND 
-	
-        args := redis.Args{i.name, query_content, "LIMIT", q.Paging.Offset, q.Paging.Num, "WITHSCORES"}
+
+	res, err := redis.Values(conn.Do(i.commandPrefix+".SEARCH", append(redis.Args{i.name, q.Term}, searchArgs(q)...)...))
+        if err != nil {
+	    fmt.Println("Here in Value", err)
+		return
+	}
+	return i.loadResults(res)
+}
+
+// SearchTimed searches like Search with FT.PROFILE, also returning the total profile time reported by RediSearch.
+// Profiling adds some overhead to the search itself
+func (i *Index) SearchTimed(q query.Query) (index.SearchResponse, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	args := append(redis.Args{i.name, "SEARCH", "QUERY", q.Term}, searchArgs(q)...)
+	res, err := redis.Values(conn.Do(i.commandPrefix+".PROFILE", args...))
+	if err != nil {
+		return index.SearchResponse{}, err
+	}
+	if len(res) < 2 {
+		return index.SearchResponse{}, errors.New("invalid profile reply")
+	}
+	results, err := redis.Values(res[0], nil)
+	if err != nil {
+		return index.SearchResponse{}, err
+	}
+	docs, total, err := i.loadResults(results)
+	if err != nil {
+		return index.SearchResponse{}, err
+	}
+	took, _ := profileTime(res[1])
+	return index.SearchResponse{Docs: docs, Total: total, Took: took}, nil
+}
+
+// searchArgs returns the arguments of a search following the query term
+func searchArgs(q query.Query) redis.Args {
+        Flag_highlight := true
+
+        args := redis.Args{"LIMIT", q.Paging.Offset, q.Paging.Num, "WITHSCORES"}
 	//if q.Flags&query.QueryVerbatim != 0 {
         args = append(args, "VERBATIM")
 	if Flag_highlight == true {
@@ -214,34 +419,254 @@ func (i *Index) Search(q query.Query) (docs []index.Document, total int, err err
 	if q.Flags&query.QueryNoContent != 0 {
 		args = append(args, "NOCONTENT")
 	}
-        //fmt.Println( args)    // ""?
-	res, err := redis.Values(conn.Do(i.commandPrefix+".SEARCH", args...))
-        if err != nil {
-	    fmt.Println("Here in Value", err)
-		return
+	return args
+}
+
+// loadResults parses the reply of a search into the total number of results and the documents of the page
+func (i *Index) loadResults(res []interface{}) (docs []index.Document, total int, err error) {
+	if len(res) == 0 {
+		return nil, 0, errors.New("empty search reply")
 	}
 	if total, err = redis.Int(res[0], nil); err != nil {
 	    fmt.Println("Here in Int")
             return
 	}
-        //fmt.Println("Results: ", total)
 	docs = make([]index.Document, 0, len(res)-1)
 
 	if len(res) > 3 {
-		for i := 1; i < len(res); i += 3 {
-
-			if i == 0 {
-				continue
-			}
+		for i := 1; i+2 < len(res); i += 3 {
 			if d, e := loadDocument(res[i], res[i+1], res[i+2]); e == nil {
 				docs = append(docs, d)
-			        //fmt.Println(d)
-                        }
+			}
+		}
+	}
+	if i.mode != LegacyMode {
+		for n := range docs {
+			docs[n] = i.fromKey(docs[n])
 		}
 	}
 	return
 }
 
+// profileTime finds the total profile time in the profile part of an FT.PROFILE reply. Its nesting differs between
+// RediSearch versions and between standalone and coordinator replies, so the key is looked up at any depth
+func profileTime(reply interface{}) (time.Duration, bool) {
+	vals, ok := reply.([]interface{})
+	if !ok {
+		return 0, false
+	}
+	for n, v := range vals {
+		if key, err := redis.String(v, nil); err == nil && key == "Total profile time" && n+1 < len(vals) {
+			ms, err := redis.Float64(vals[n+1], nil)
+			if err != nil {
+				return 0, false
+			}
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+		if took, found := profileTime(v); found {
+			return took, true
+		}
+	}
+	return 0, false
+}
+
+// fromKey converts a document loaded from a hash or JSON key to the indexed document, stripping the
+// key prefix from its id and expanding the JSON root if it was returned
+func (i *Index) fromKey(doc index.Document) index.Document {
+	doc.Id = strings.TrimPrefix(doc.Id, i.keyPrefix)
+	if root, ok := doc.Properties["$"].(string); ok {
+		delete(doc.Properties, "$")
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(root), &obj); err == nil {
+			for k, v := range obj {
+				if _, found := doc.Properties[k]; !found {
+					doc.Set(k, v)
+				}
+			}
+		}
+	}
+	delete(doc.Properties, scoreField)
+	delete(doc.Properties, languageField)
+	return doc
+}
+
+// ScanDocuments iterates over all the documents of the index in batches of about batch documents, calling fn
+// for each batch. fn may delete the documents of its batch from the index without disrupting the scan
+func (i *Index) ScanDocuments(batch int, fn func([]index.Document) error) error {
+	if i.mode == LegacyMode {
+		return i.scanLegacy(batch, fn)
+	}
+
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	cursor := 0
+	for {
+		res, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", i.keyPrefix+"*", "COUNT", batch))
+		if err != nil {
+			return err
+		}
+		if cursor, err = redis.Int(res[0], nil); err != nil {
+			return err
+		}
+		keys, err := redis.Strings(res[1], nil)
+		if err != nil {
+			return err
+		}
+
+		docs, err := i.loadKeys(conn, keys)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			if err := fn(docs); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// scanLegacy scans the documents of a LegacyMode index by paging through a wildcard query from the last page
+// backwards, so documents deleted from the current page don't shift the pages yet to be read
+func (i *Index) scanLegacy(batch int, fn func([]index.Document) error) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	res, err := redis.Values(conn.Do(i.commandPrefix+".SEARCH", i.name, "*", "LIMIT", 0, 0))
+	if err != nil {
+		return err
+	}
+	total, err := redis.Int(res[0], nil)
+	if err != nil {
+		return err
+	}
+
+	for top := total; top > 0; top -= batch {
+		offset := top - batch
+		if offset < 0 {
+			offset = 0
+		}
+		res, err := redis.Values(conn.Do(i.commandPrefix+".SEARCH", i.name, "*", "LIMIT", offset, top-offset, "WITHSCORES"))
+		if err != nil {
+			return err
+		}
+		docs := make([]index.Document, 0, top-offset)
+		for n := 1; n+2 < len(res); n += 3 {
+			if d, e := loadDocument(res[n], res[n+1], res[n+2]); e == nil {
+				docs = append(docs, d)
+			}
+		}
+		if err := fn(docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadKeys loads the documents stored in hash or JSON keys
+func (i *Index) loadKeys(conn redis.Conn, keys []string) ([]index.Document, error) {
+	for _, k := range keys {
+		var err error
+		if i.mode == JSONMode {
+			err = conn.Send("JSON.GET", k)
+		} else {
+			err = conn.Send("HGETALL", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	docs := make([]index.Document, 0, len(keys))
+	for _, k := range keys {
+		reply, err := conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+		doc := index.NewDocument(strings.TrimPrefix(k, i.keyPrefix), 0)
+
+		var props map[string]interface{}
+		if i.mode == JSONMode {
+			b, err := redis.Bytes(reply, nil)
+			if err != nil {
+				// the key was deleted since it was scanned
+				continue
+			}
+			if err := json.Unmarshal(b, &props); err != nil {
+				return nil, err
+			}
+		} else {
+			m, err := redis.StringMap(reply, nil)
+			if err != nil || len(m) == 0 {
+				continue
+			}
+			props = make(map[string]interface{}, len(m))
+			for f, v := range m {
+				props[f] = v
+			}
+		}
+
+		if sc, found := props[scoreField]; found {
+			if score, err := strconv.ParseFloat(fmt.Sprint(sc), 64); err == nil {
+				doc.Score = float32(score)
+			}
+		}
+		delete(props, scoreField)
+		delete(props, languageField)
+		doc.Properties = props
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// DeleteDocuments deletes documents from the index by their ids
+func (i *Index) DeleteDocuments(ids ...string) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	for _, id := range ids {
+		var err error
+		if i.mode == LegacyMode {
+			// the document hash is kept, since another index on the same server may use the same key
+			err = conn.Send(i.commandPrefix+".DEL", i.name, id)
+		} else {
+			err = conn.Send("DEL", i.keyPrefix+id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for range ids {
+		if _, err := conn.Receive(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropIndex drops just this index and its remaining documents, unlike Drop that flushes the whole server
+func (i *Index) DropIndex() error {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	var err error
+	if i.mode == LegacyMode {
+		_, err = conn.Do(i.commandPrefix+".DROP", i.name, "KEEPDOCS")
+	} else {
+		_, err = conn.Do(i.commandPrefix+".DROPINDEX", i.name, "DD")
+	}
+	return err
+}
+
 // Drop the index. Currentl just flushes the DB - note that this will delete EVERYTHING on the redis instance
 func (i *Index) Drop() error {
 	conn := i.pool.Get()
@@ -0,0 +1,188 @@
+package redisearch
+
+import (
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// Partitioner is the interface that generates partition keys for index keys
+type Partitioner interface {
+	PartitionFor(id string) uint32
+	// Partitions returns the number of partitions keys are placed on
+	Partitions() int
+}
+
+// checkPartitioner checks that a partitioner places keys on the given number of partitions
+func checkPartitioner(p Partitioner, partitions int) error {
+	if n := p.Partitions(); n != partitions {
+		return fmt.Errorf("partitioner places keys on %d partitions instead of %d", n, partitions)
+	}
+	return nil
+}
+
+// DocumentPartitioner is implemented by partitioners that place documents by their contents rather than their id.
+// Ids are still partitioned with PartitionFor, e.g. for suggestion terms
+type DocumentPartitioner interface {
+	Partitioner
+	PartitionForDocument(doc index.Document) uint32
+}
+
+// ModuloPartitioner partitions keys based on simple static modulo based hashing function (using crc32)
+type ModuloPartitioner struct {
+	n int
+}
+
+// NewModuloPartitioner creates a modulo partitioner over n partitions
+func NewModuloPartitioner(n int) ModuloPartitioner {
+	return ModuloPartitioner{n}
+}
+
+// PartitionFor returns a partition number of a given key
+func (m ModuloPartitioner) PartitionFor(id string) uint32 {
+	return crc32.ChecksumIEEE([]byte(id)) % uint32(m.n)
+}
+
+// Partitions returns the number of partitions
+func (m ModuloPartitioner) Partitions() int {
+	return m.n
+}
+
+// hash64 hashes a key to 64 bits with FNV-1a
+func hash64(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
+
+// JumpPartitioner partitions keys with Jump Consistent Hash (Lamping & Veach). When the number of partitions
+// grows from n to n+1, only 1/(n+1) of the keys move, all of them to the new partition
+type JumpPartitioner struct {
+	n int
+}
+
+// NewJumpPartitioner creates a jump consistent hash partitioner over n partitions
+func NewJumpPartitioner(n int) JumpPartitioner {
+	return JumpPartitioner{n}
+}
+
+// Partitions returns the number of partitions
+func (j JumpPartitioner) Partitions() int {
+	return j.n
+}
+
+// PartitionFor returns a partition number of a given key
+func (j JumpPartitioner) PartitionFor(id string) uint32 {
+	key := hash64(id)
+	var b, n int64 = -1, 0
+	for n < int64(j.n) {
+		b = n
+		key = key*2862933555777941757 + 1
+		n = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return uint32(b)
+}
+
+// RendezvousPartitioner partitions keys with Rendezvous (highest random weight) hashing - each key goes to the
+// partition with the highest hash of the key and partition number. Changing the number of partitions only moves
+// the keys of the added or removed partitions
+type RendezvousPartitioner struct {
+	n int
+}
+
+// NewRendezvousPartitioner creates a rendezvous hash partitioner over n partitions
+func NewRendezvousPartitioner(n int) RendezvousPartitioner {
+	return RendezvousPartitioner{n}
+}
+
+// mix64 is the splitmix64 finalizer, used to derive independent per-partition weights from a key hash
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Partitions returns the number of partitions
+func (r RendezvousPartitioner) Partitions() int {
+	return r.n
+}
+
+// PartitionFor returns a partition number of a given key
+func (r RendezvousPartitioner) PartitionFor(id string) uint32 {
+	key := hash64(id)
+	var best uint32
+	var bestWeight uint64
+	for p := 0; p < r.n; p++ {
+		if w := mix64(key ^ mix64(uint64(p)+1)); p == 0 || w > bestWeight {
+			best, bestWeight = uint32(p), w
+		}
+	}
+	return best
+}
+
+// RangePartitioner partitions documents by ranges of a numeric document field. Partition i holds the documents
+// whose value is below bounds[i], and the last partition holds all the rest, so there are len(bounds)+1 partitions.
+// Keys and documents without a numeric value are partitioned by a jump consistent hash of their id
+type RangePartitioner struct {
+	field  string
+	bounds []float64
+}
+
+// NewRangePartitioner creates a range partitioner on the given field, with ascending partition upper bounds
+func NewRangePartitioner(field string, bounds ...float64) RangePartitioner {
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	return RangePartitioner{
+		field:  field,
+		bounds: sorted,
+	}
+}
+
+// Partitions returns the number of partitions, one more than the number of bounds
+func (r RangePartitioner) Partitions() int {
+	return len(r.bounds) + 1
+}
+
+// PartitionFor returns a partition number of a given key, by its hash
+func (r RangePartitioner) PartitionFor(id string) uint32 {
+	return JumpPartitioner{len(r.bounds) + 1}.PartitionFor(id)
+}
+
+// PartitionForDocument returns the partition number of the range the document's field value falls in
+func (r RangePartitioner) PartitionForDocument(doc index.Document) uint32 {
+	var v float64
+	switch x := doc.Properties[r.field].(type) {
+	case float64:
+		v = x
+	case float32:
+		v = float64(x)
+	case int:
+		v = float64(x)
+	case int64:
+		v = float64(x)
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return r.PartitionFor(doc.Id)
+		}
+		v = f
+	default:
+		return r.PartitionFor(doc.Id)
+	}
+	return uint32(sort.Search(len(r.bounds), func(i int) bool { return v < r.bounds[i] }))
+}
+
+// partitionForDocument returns the partition of a document with the given partitioner
+func partitionForDocument(p Partitioner, doc index.Document) uint32 {
+	if dp, ok := p.(DocumentPartitioner); ok {
+		return dp.PartitionForDocument(doc)
+	}
+	return p.PartitionFor(doc.Id)
+}
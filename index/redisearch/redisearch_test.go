@@ -1,11 +1,17 @@
 package redisearch
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
+	"github.com/garyburd/redigo/redis"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +21,7 @@ func TestIndex(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx := NewIndex("localhost:6379", "testung", md)
+	idx := NewIndex("localhost:6379", "testung", md, nil)
 
 	docs := []index.Document{
 		index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("score", 1),
@@ -45,12 +51,78 @@ func TestIndex(t *testing.T) {
 
 }
 
+func TestFullSchema(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 10)).
+		AddField(index.NewTextField("body", 1)).
+		AddField(index.NewNumericField("score")).
+		AddField(index.NewGeoField("location")).
+		AddField(index.NewValueField("tags", ",")).
+		AddField(index.NewNoIndexField("url"))
+	md.Options = IndexingOptions{NoScoreIndexes: true}
+
+	idx := NewIndex("localhost:6379", "schematest", md, nil)
+
+	docs := []index.Document{
+		index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("body", "lorem ipsum").
+			Set("score", 1).Set("location", [2]float64{-0.1, 51.5}).Set("tags", []string{"foo", "bar"}).
+			Set("url", "http://example.com/doc1"),
+		index.NewDocument("doc2", 1.0).Set("title", "foo bar").Set("body", "hello lorem").
+			Set("score", 2).Set("location", "2.35,48.85").Set("tags", "baz"),
+	}
+
+	assert.NoError(t, idx.Drop())
+	assert.NoError(t, idx.Create())
+	assert.NoError(t, idx.Index(docs, nil))
+
+	docs, total, err := idx.Search(*query.NewQuery(idx.name, "@tags:{foo}"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "doc1", docs[0].Id)
+	assert.Equal(t, "http://example.com/doc1", docs[0].Properties["url"])
+
+	docs, total, err = idx.Search(*query.NewQuery(idx.name, "@location:[2.3 48.8 10 km]"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "doc2", docs[0].Id)
+}
+
+func TestHashMode(t *testing.T) {
+	for _, mode := range []IndexingMode{HashMode, JSONMode} {
+		md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
+			AddField(index.NewNumericField("score"))
+		md.Options = IndexingOptions{Mode: mode}
+
+		idx := NewIndex("localhost:6379", "hashtest", md, nil)
+
+		docs := []index.Document{
+			index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("score", 1),
+			index.NewDocument("doc2", 1.0).Set("title", "foo bar hello").Set("score", 2),
+		}
+
+		assert.NoError(t, idx.Drop())
+		assert.NoError(t, idx.Create())
+		assert.NoError(t, idx.Index(docs, nil))
+
+		docs, total, err := idx.Search(*query.NewQuery(idx.name, "hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Len(t, docs, 2)
+		ids := []string{}
+		for _, d := range docs {
+			ids = append(ids, d.Id)
+		}
+		assert.ElementsMatch(t, []string{"doc1", "doc2"}, ids)
+	}
+}
+
 func TestPaging(t *testing.T) {
 
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx := NewDistributedIndex("td", []string{"localhost:6379"}, 4, md)
+	idx, err := NewDistributedIndex("td", []string{"localhost:6379"}, 4, md, nil)
+	assert.NoError(t, err)
 
 	assert.NoError(t, idx.Drop())
 	assert.NoError(t, idx.Create())
@@ -87,7 +159,8 @@ func TestDistributedIndex(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx := NewDistributedIndex("dtest", []string{"localhost:6379"}, 2, md)
+	idx, err := NewDistributedIndex("dtest", []string{"localhost:6379"}, 2, md, nil)
+	assert.NoError(t, err)
 
 	docs := []index.Document{
 		index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("score", 1),
@@ -118,7 +191,7 @@ func TestDistributedIndex(t *testing.T) {
 
 	suggs := []index.Suggestion{}
 	for i := 0; i < 100; i++ {
-		suggs = append(suggs, index.Suggestion{fmt.Sprintf("suggestion %d", i), float64(i)})
+		suggs = append(suggs, index.Suggestion{Term: fmt.Sprintf("suggestion %d", i), Score: float64(i)})
 	}
 
 	assert.NoError(t, idx.AddTerms(suggs...))
@@ -132,13 +205,14 @@ func TestDistributedIndex(t *testing.T) {
 
 func TestAutocompleter(t *testing.T) {
 	//t.SkipNow()
-	ac := NewAutocompleter("localhost:6379", "ac")
+	ac := NewAutocompleter("localhost:6379", "ac", nil)
 
 	assert.NotNil(t, ac)
+	assert.NoError(t, ac.Delete())
 	assert.NoError(t, ac.AddTerms(
-		index.Suggestion{"hello world", 1},
-		index.Suggestion{"hello", 2},
-		index.Suggestion{"jello world", 3},
+		index.Suggestion{Term: "hello world", Score: 1},
+		index.Suggestion{Term: "hello", Score: 2},
+		index.Suggestion{Term: "jello world", Score: 3},
 	))
 
 	suggs, err := ac.Suggest("hel", 10, false)
@@ -148,4 +222,689 @@ func TestAutocompleter(t *testing.T) {
 	suggs, err = ac.Suggest("hel", 10, true)
 	assert.NoError(t, err)
 	assert.Len(t, suggs, 3)
+
+	assert.NoError(t, ac.AddTerms(index.Suggestion{Term: "help", Score: 1, Payload: "doc1"}))
+	assert.NoError(t, ac.IncrTerms(index.Suggestion{Term: "help", Score: 9}))
+	suggs, err = ac.Suggest("help", 1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, suggs, 1) {
+		assert.Equal(t, "doc1", suggs[0].Payload)
+	}
+
+	n, err := ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = ac.DeleteTerms("help", "nosuchterm")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestAggregationArgs(t *testing.T) {
+	a := NewAggregation("hello").
+		Load("@url").
+		GroupBy([]string{"@title"}, ReduceCount("num"), ReduceAvg("@score", "avg")).
+		Apply("@num * 2", "double").
+		Filter("@num > 1").
+		SortBy(10, SortKey{"@num", false}).
+		Limit(0, 5).
+		WithCursor(100, time.Second)
+
+	assert.Equal(t, "[idx hello LOAD 1 @url GROUPBY 1 @title REDUCE COUNT 0 AS num REDUCE AVG 1 @score AS avg "+
+		"APPLY @num * 2 AS double FILTER @num > 1 SORTBY 2 @num DESC MAX 10 LIMIT 0 5 WITHCURSOR COUNT 100 MAXIDLE 1000]",
+		fmt.Sprint(a.args("idx")))
+
+	a, err := ParseAggregation(`*  GROUPBY 1 @title REDUCE COUNT 0 AS n APPLY "upper(@title)" AS t WITHCURSOR COUNT 10`)
+	assert.NoError(t, err)
+	assert.Equal(t, "*", a.Query)
+	assert.True(t, a.cursor)
+	assert.Equal(t, "[idx * GROUPBY 1 @title REDUCE COUNT 0 AS n APPLY upper(@title) AS t WITHCURSOR COUNT 10]",
+		fmt.Sprint(a.args("idx")))
+}
+
+func TestAggregate(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
+		AddField(index.NewNumericField("score"))
+
+	idx := NewIndex("localhost:6379", "aggtest", md, nil)
+
+	docs := []index.Document{}
+	for i := 0; i < 100; i++ {
+		docs = append(docs, index.NewDocument(fmt.Sprintf("doc%d", i), 1).
+			Set("title", fmt.Sprintf("hello title%d", i%10)).Set("score", i))
+	}
+
+	assert.NoError(t, idx.Drop())
+	assert.NoError(t, idx.Create())
+	assert.NoError(t, idx.Index(docs, nil))
+
+	rows, cursor, err := idx.Aggregate(NewAggregation("hello").
+		Load("@title").
+		GroupBy([]string{"@title"}, ReduceCount("num")).
+		SortBy(0, SortKey{"@title", true}))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cursor)
+	assert.Len(t, rows, 10)
+	assert.Equal(t, "hello title0", rows[0]["title"])
+	assert.Equal(t, "10", rows[0]["num"])
+
+	rows, err = idx.AggregateAll(NewAggregation("hello").Load("@score").WithCursor(30, 0))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 100)
+}
+
+func TestSpellCheck(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0))
+	idx := NewIndex("localhost:6379", "spelltest", md, nil)
+
+	docs := []index.Document{
+		index.NewDocument("doc1", 1).Set("title", "hello world"),
+		index.NewDocument("doc2", 1).Set("title", "help wanted"),
+	}
+	assert.NoError(t, idx.Drop())
+	assert.NoError(t, idx.Create())
+	assert.NoError(t, idx.Index(docs, nil))
+
+	terms, err := idx.SpellCheck("helo wrld", SpellCheckOptions{Distance: 1})
+	assert.NoError(t, err)
+	assert.Len(t, terms, 2)
+	assert.Equal(t, "helo", terms[0].Term)
+	assert.Len(t, terms[0].Suggestions, 2)
+
+	n, err := idx.DictAdd("dict", "wrld", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	terms, err = idx.SpellCheck("helo wrld", SpellCheckOptions{Exclude: []string{"dict"}})
+	assert.NoError(t, err)
+	assert.Len(t, terms, 1)
+	n, err = idx.DictDel("dict", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	dict, err := idx.DictDump("dict")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"wrld"}, dict)
+
+	assert.NoError(t, idx.SynUpdate("g1", "hello", "hi"))
+	syns, err := idx.SynDump()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"g1"}, syns["hi"])
+}
+
+func TestMergeMisspelledTerms(t *testing.T) {
+	// "wrld" is in the index of partition 1, "helo" is misspelled everywhere
+	results := []taskResult[[]MisspelledTerm]{
+		{Id: 1, Value: []MisspelledTerm{
+			{Term: "helo", Suggestions: []index.Suggestion{{Term: "hello", Score: 0.5}, {Term: "help", Score: 0.25}}},
+		}},
+		{Id: 0, Value: []MisspelledTerm{
+			{Term: "helo", Suggestions: []index.Suggestion{{Term: "hello", Score: 0.25}, {Term: "halo", Score: 0.75}}},
+			{Term: "wrld", Suggestions: []index.Suggestion{{Term: "world", Score: 1}}},
+		}},
+	}
+	assert.Equal(t, []MisspelledTerm{
+		{Term: "helo", Suggestions: []index.Suggestion{
+			{Term: "halo", Score: 0.75}, {Term: "hello", Score: 0.5}, {Term: "help", Score: 0.25},
+		}},
+	}, mergeMisspelledTerms(results))
+}
+
+func TestKeySlot(t *testing.T) {
+	assert.EqualValues(t, 0x31C3, crc16([]byte("123456789")))
+	assert.Equal(t, 12182, keySlot("foo"))
+	assert.Equal(t, keySlot("user1000"), keySlot("{user1000}.following"))
+	assert.Equal(t, keySlot("3"), keySlot("wik{3}"))
+	assert.Equal(t, keySlot("foo{}bar"), keySlot("foo{}bar"))
+
+	kind, addr, ok := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"))
+	assert.True(t, ok)
+	assert.Equal(t, "MOVED", kind)
+	assert.Equal(t, "127.0.0.1:6381", addr)
+	_, _, ok = parseRedirect(redis.Error("ERR unknown command"))
+	assert.False(t, ok)
+}
+
+func TestClusterShards(t *testing.T) {
+	// a CLUSTER SHARDS reply as parsed by redigo, with bulk strings and integers mixed in the node properties
+	node := func(id, ip string, port int64, role string) []interface{} {
+		return []interface{}{
+			[]byte("id"), []byte(id), []byte("port"), port, []byte("ip"), []byte(ip),
+			[]byte("endpoint"), []byte(ip), []byte("role"), []byte(role),
+			[]byte("replication-offset"), int64(72156), []byte("health"), []byte("online"),
+		}
+	}
+	reply := []interface{}{
+		[]interface{}{
+			[]byte("slots"), []interface{}{int64(0), int64(5460)},
+			[]byte("nodes"), []interface{}{node("a", "10.0.0.1", 30001, "master"), node("b", "10.0.0.2", 30004, "replica")},
+		},
+		[]interface{}{
+			[]byte("slots"), []interface{}{int64(5461), int64(10922), int64(10923), int64(16383)},
+			[]byte("nodes"), []interface{}{node("c", "?", 30002, "master")},
+		},
+	}
+	ranges, err := parseClusterShards(reply, "seed:30001")
+	assert.NoError(t, err)
+	assert.Equal(t, []slotRange{
+		{0, 5460, "10.0.0.1:30001"},
+		{5461, 10922, "seed:30002"},
+		{10923, 16383, "seed:30002"},
+	}, ranges)
+
+	// without any online master the reply is rejected, to fall back to CLUSTER SLOTS
+	_, err = parseClusterShards([]interface{}{}, "seed:30001")
+	assert.Error(t, err)
+}
+
+func TestPartitioners(t *testing.T) {
+	const N = 100000
+	const parts = 10
+
+	for name, ctor := range map[string]func(int) Partitioner{
+		"modulo":     func(n int) Partitioner { return NewModuloPartitioner(n) },
+		"jump":       func(n int) Partitioner { return NewJumpPartitioner(n) },
+		"rendezvous": func(n int) Partitioner { return NewRendezvousPartitioner(n) },
+	} {
+		p, grown := ctor(parts), ctor(parts+1)
+		counts := make([]int, parts)
+		moved := 0
+		for i := 0; i < N; i++ {
+			id := fmt.Sprintf("doc%d", i)
+			before := p.PartitionFor(id)
+			counts[before]++
+			if after := grown.PartitionFor(id); after != before {
+				moved++
+				if name != "modulo" {
+					// consistent partitioners only move keys to the new partition
+					assert.EqualValues(t, parts, after, name)
+				}
+			}
+		}
+
+		// every partition should be within 5% of a fair share
+		for _, c := range counts {
+			assert.InDelta(t, N/parts, c, N/parts*0.05, name)
+		}
+
+		if name == "modulo" {
+			assert.True(t, moved > N/2, name)
+		} else {
+			// ideally 1/(n+1) of the keys move
+			assert.InDelta(t, N/(parts+1), moved, N/(parts+1)*0.1, name)
+		}
+	}
+}
+
+func TestRangePartitioner(t *testing.T) {
+	p := NewRangePartitioner("score", 10, 100)
+	assert.EqualValues(t, 0, p.PartitionForDocument(index.NewDocument("a", 1).Set("score", 5)))
+	assert.EqualValues(t, 1, p.PartitionForDocument(index.NewDocument("b", 1).Set("score", 10)))
+	assert.EqualValues(t, 1, p.PartitionForDocument(index.NewDocument("c", 1).Set("score", "50.5")))
+	assert.EqualValues(t, 2, p.PartitionForDocument(index.NewDocument("d", 1).Set("score", 1000.0)))
+	assert.True(t, p.PartitionForDocument(index.NewDocument("e", 1)) < 3)
+
+	// a partitioner over another number of partitions than the index is rejected
+	assert.Equal(t, 3, p.Partitions())
+	md := index.NewMetadata().AddField(index.NewNumericField("score"))
+	_, err := NewDistributedIndex("rp", []string{"localhost:6379"}, 2, md, nil, WithPartitioner(p))
+	assert.Error(t, err)
+	idx, err := NewDistributedIndex("rp", []string{"localhost:6379"}, 3, md, nil, WithPartitioner(p))
+	assert.NoError(t, err)
+	assert.Error(t, idx.Reshard(4, p, nil))
+	idx.Close()
+}
+
+func TestReshard(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0))
+	md.Options = IndexingOptions{Mode: HashMode}
+
+	idx, err := NewDistributedIndex("rs", []string{"localhost:6379"}, 2, md, nil, WithPartitioner(NewJumpPartitioner(2)),
+		WithPrefixRouting(2))
+	assert.NoError(t, err)
+	assert.NoError(t, idx.Drop())
+	assert.NoError(t, idx.Create())
+	terms := []index.Suggestion{{Term: "hello", Score: 1}, {Term: "help", Score: 1}, {Term: "world", Score: 1}}
+	assert.NoError(t, idx.AddTerms(terms...))
+
+	N := 1000
+	docs := make([]index.Document, 0, N)
+	for i := 0; i < N; i++ {
+		docs = append(docs, index.NewDocument(fmt.Sprintf("doc%d", i), 1).Set("title", fmt.Sprintf("hello title%d", i)))
+	}
+	assert.NoError(t, idx.Index(docs, nil))
+
+	var last ReshardProgress
+	assert.NoError(t, idx.Reshard(4, NewJumpPartitioner(4), func(p ReshardProgress) { last = p }))
+	assert.Equal(t, N, last.Scanned)
+	assert.InDelta(t, N/2, last.Moved, float64(N)/10)
+
+	_, total, err := idx.Search(*query.NewQuery("rs", "hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, N, total)
+
+	docs, total, err = idx.Search(*query.NewQuery("rs", "title42"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "doc42", docs[0].Id)
+
+	// suggestions stay where they were added
+	suggs, err := idx.Suggest("hel", 10, false)
+	assert.NoError(t, err)
+	assert.Len(t, suggs, 2)
+	n, err := idx.DeleteTerms("world")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestShardTimeout(t *testing.T) {
+	e := newExecutor(2)
+	defer e.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tg := newTaskGroup[searchResult](ctx, e, 2)
+	// the slow task ignores the cancellation, so that it answers well after the timeout
+	for n, d := range []time.Duration{0, 200 * time.Millisecond} {
+		n, d := n, d
+		assert.NoError(t, tg.Submit(n, func(ctx context.Context) (searchResult, error) {
+			time.Sleep(d)
+			return searchResult{}, nil
+		}))
+	}
+	assert.Equal(t, errGroupFull, tg.Submit(2, func(context.Context) (searchResult, error) {
+		return searchResult{}, nil
+	}))
+
+	results, err := tg.Wait()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Len(t, results, 1)
+
+	shards := shardInfos(results, 2, 50*time.Millisecond)
+	assert.NoError(t, shards[0].Err)
+	assert.Equal(t, ShardInfo{Partition: 1, Latency: 50 * time.Millisecond, Err: ErrShardTimeout}, shards[1])
+	assert.Equal(t, []ShardError{{1, ErrShardTimeout}}, shardFailures(shards))
+
+	// a late result is still attributed to the partition it was submitted for
+	late := <-tg.results
+	assert.Equal(t, 1, late.Id)
+
+	// results received before the timeout are all returned, even if the timeout is noticed first
+	for x := 0; x < 20; x++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		tg := newTaskGroup[int](ctx, e, 2)
+		for n := 0; n < 2; n++ {
+			assert.NoError(t, tg.Submit(n, func(context.Context) (int, error) { return 0, nil }))
+		}
+		for len(tg.results) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		results, _ := tg.Wait()
+		assert.Len(t, results, 2)
+	}
+}
+
+func TestExecutor(t *testing.T) {
+	// a single worker makes the second task wait for the first one
+	e := newExecutor(1)
+	tg := newTaskGroup[int](context.Background(), e, 2)
+	for n := 0; n < 2; n++ {
+		n := n
+		assert.NoError(t, tg.Submit(n, func(context.Context) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			if n == 1 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}))
+	}
+	results, err := tg.Wait()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []taskResult[int]{{0, 0, nil}, {1, 0, io.EOF}}, results)
+
+	st := e.Stats()
+	assert.EqualValues(t, 2, st.Tasks)
+	assert.EqualValues(t, 0, st.QueueDepth)
+	assert.True(t, st.MaxWait >= 10*time.Millisecond)
+
+	e.Shutdown()
+	tg = newTaskGroup[int](context.Background(), e, 1)
+	assert.Equal(t, errShutdown, tg.Submit(0, func(context.Context) (int, error) { return 0, nil }))
+}
+
+// slowIndex is a fake sub-index answering searches after a delay, failing its first failures searches
+type slowIndex struct {
+	delay    func() time.Duration
+	failures int32
+	searches int32
+}
+
+func (s *slowIndex) Index(documents []index.Document, options interface{}) error { return nil }
+func (s *slowIndex) Refresh() error                                              { return nil }
+func (s *slowIndex) Drop() error                                                 { return nil }
+func (s *slowIndex) Create() error                                               { return nil }
+func (s *slowIndex) Search(q query.Query) ([]index.Document, int, error) {
+	atomic.AddInt32(&s.searches, 1)
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		return nil, 0, io.EOF
+	}
+	time.Sleep(s.delay())
+	return []index.Document{index.NewDocument("doc1", 1)}, 1, nil
+}
+
+func TestHedging(t *testing.T) {
+	// every 10th request is very slow, hedging should answer those in about twice the usual latency
+	var n int32
+	sub := &slowIndex{delay: func() time.Duration {
+		if atomic.AddInt32(&n, 1)%10 == 0 {
+			return 200 * time.Millisecond
+		}
+		return time.Millisecond
+	}}
+	idx := newDistributedIndex(1, func(int, int, int) (index.Index, index.Autocompleter) { return sub, nil },
+		[]DistributedOption{WithHedging(0.8, 0)})
+
+	var slowest time.Duration
+	for x := 0; x < 300; x++ {
+		st := time.Now()
+		docs, _, err := idx.Search(*query.NewQuery("", "hello").Limit(0, 1))
+		assert.NoError(t, err)
+		assert.Len(t, docs, 1)
+		if x > minHedgeSamples && time.Since(st) > slowest {
+			slowest = time.Since(st)
+		}
+	}
+	st := idx.HedgeStats()
+	assert.True(t, st.HedgesSent > 0)
+	assert.True(t, st.HedgesWon > 0)
+	assert.True(t, slowest < 100*time.Millisecond)
+
+	// transient errors are retried
+	sub = &slowIndex{delay: func() time.Duration { return 0 }, failures: 2}
+	idx = newDistributedIndex(1, func(int, int, int) (index.Index, index.Autocompleter) { return sub, nil },
+		[]DistributedOption{WithRetries(2, time.Millisecond)})
+	_, _, err := idx.Search(*query.NewQuery("", "hello").Limit(0, 1))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, idx.HedgeStats().Retries)
+}
+
+// timedIndex is a fake sub-index reporting a fixed server side time for its searches
+type timedIndex struct {
+	slowIndex
+	took time.Duration
+}
+
+func (s *timedIndex) SearchTimed(q query.Query) (index.SearchResponse, error) {
+	docs, total, err := s.Search(q)
+	return index.SearchResponse{Docs: docs, Total: total, Took: s.took}, err
+}
+
+func TestSearchTimed(t *testing.T) {
+	// partitions are searched in parallel, the slowest one sets the server side time
+	idx := newDistributedIndex(3, func(n, r, _ int) (index.Index, index.Autocompleter) {
+		return &timedIndex{slowIndex: slowIndex{delay: func() time.Duration { return 0 }},
+			took: time.Duration(n+r+1) * time.Millisecond}, nil
+	}, []DistributedOption{WithReplicas(ReplicaOptions{Replicas: 2, Balancer: RoundRobin})})
+	res, err := idx.SearchTimed(*query.NewQuery("", "hello").Limit(0, 5))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res.Total)
+	assert.Len(t, res.Docs, 3)
+	assert.True(t, res.Took >= 3*time.Millisecond && res.Took <= 4*time.Millisecond)
+
+	// the profile time is found at any depth of the FT.PROFILE reply
+	took, found := profileTime([]interface{}{
+		[]interface{}{[]byte("Total profile time"), []byte("1.5")},
+		[]interface{}{[]byte("Parsing time"), []byte("0.1")},
+	})
+	assert.True(t, found)
+	assert.Equal(t, 1500*time.Microsecond, took)
+	_, found = profileTime([]interface{}{[]byte("Shards"), []interface{}{}})
+	assert.False(t, found)
+}
+
+func TestReplicas(t *testing.T) {
+	var subs []*slowIndex
+	newIdx := func(opts ReplicaOptions) *DistributedIndex {
+		subs = nil
+		return newDistributedIndex(1, func(n, r, _ int) (index.Index, index.Autocompleter) {
+			sub := &slowIndex{delay: func() time.Duration { return 0 }}
+			subs = append(subs, sub)
+			return sub, nil
+		}, []DistributedOption{WithReplicas(opts)})
+	}
+	search := func(idx *DistributedIndex, num int) {
+		for x := 0; x < num; x++ {
+			_, _, err := idx.Search(*query.NewQuery("", "hello").Limit(0, 1))
+			assert.NoError(t, err)
+		}
+	}
+
+	// round robin spreads the reads evenly
+	idx := newIdx(ReplicaOptions{Replicas: 3, Balancer: RoundRobin})
+	search(idx, 30)
+	for _, sub := range subs {
+		assert.EqualValues(t, 10, sub.searches)
+	}
+
+	// a replica failing with connection errors is skipped until the failover period passes
+	for _, b := range []ReplicaBalancer{RoundRobin, LeastOutstanding, LatencyEWMA} {
+		idx = newIdx(ReplicaOptions{Replicas: 2, Balancer: b, FailoverPeriod: time.Minute})
+		subs[0].failures = 1000
+		search(idx, 20)
+		assert.True(t, subs[0].searches <= 1)
+		assert.EqualValues(t, 20, subs[1].searches)
+	}
+}
+
+// brokenIndex is a fake sub-index failing all writes
+type brokenIndex struct {
+	slowIndex
+}
+
+func (b *brokenIndex) Index(documents []index.Document, options interface{}) error { return io.EOF }
+
+func TestIndexErrors(t *testing.T) {
+	idx := newDistributedIndex(2, func(n, r, _ int) (index.Index, index.Autocompleter) {
+		if n == 1 {
+			return &brokenIndex{}, nil
+		}
+		return &slowIndex{}, nil
+	}, nil)
+	docs := []index.Document{}
+	for n := 0; n < 10; n++ {
+		docs = append(docs, index.NewDocument(fmt.Sprintf("doc%d", n), 1))
+	}
+	assert.Equal(t, io.EOF, idx.Index(docs, nil))
+}
+
+func TestGlobalScoring(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
+		AddField(index.NewNumericField("group"))
+
+	// the range partitioner puts all the documents mentioning apples on the first partition, so local term
+	// statistics differ a lot from the global ones
+	docs := []index.Document{}
+	for n := 0; n < 40; n++ {
+		title := strings.Repeat("cherry ", 1+n%4) + fmt.Sprintf("filler%d", n)
+		if n < 10 {
+			title = strings.Repeat("apple ", 1+n%3) + title
+		}
+		docs = append(docs, index.NewDocument(fmt.Sprintf("doc%d", n), 1).Set("title", title).Set("group", n))
+	}
+
+	single := NewIndex("localhost:6379", "gstest", md, nil)
+	dist, err := NewDistributedIndex("gdtest", []string{"localhost:6379"}, 4, md, nil,
+		WithPartitioner(NewRangePartitioner("group", 10, 20, 30)), WithGlobalScoring())
+	assert.NoError(t, err)
+	// Drop flushes the whole server both indexes are on, so both are dropped before either is created
+	for _, idx := range []index.Index{single, dist} {
+		idx.Drop()
+	}
+	for _, idx := range []index.Index{single, dist} {
+		assert.NoError(t, idx.Create())
+		assert.NoError(t, idx.Index(docs, nil))
+	}
+
+	for _, term := range []string{"cherry", "apple cherry", "apple | cherry"} {
+		q := query.NewQuery("", term).Limit(0, 10)
+		expected, _, err := single.Search(*q)
+		assert.NoError(t, err)
+		got, _, err := dist.Search(*q)
+		assert.NoError(t, err)
+
+		assert.Len(t, got, len(expected))
+		scores := map[string]float32{}
+		for _, d := range expected {
+			scores[d.Id] = d.Score
+		}
+		for n, d := range got {
+			assert.InDelta(t, expected[n].Score, d.Score, 0.001*float64(d.Score), term)
+			if s, found := scores[d.Id]; found {
+				assert.InDelta(t, s, d.Score, 0.001*float64(d.Score), term)
+			}
+		}
+	}
+}
+
+func TestRescore(t *testing.T) {
+	assert.Equal(t, []string{"hello", "title", "world"}, queryTerms("Hello @title:world|hello TITLE"))
+
+	// a term found on one partition only is as rare globally as on that partition
+	results := []taskResult[searchResult]{
+		{Value: searchResult{
+			docs:  []index.Document{index.NewDocument("a", 2)},
+			terms: &partitionTerms{10, map[string]int{"x": 1}, map[string]map[string]float64{"x": {"a": 2}}},
+		}},
+		{Value: searchResult{
+			docs:  []index.Document{index.NewDocument("b", 3)},
+			terms: &partitionTerms{30, map[string]int{"x": 0, "y": 3}, map[string]map[string]float64{"y": {"b": 3}}},
+		}},
+	}
+	rescore(results, []string{"x", "y"})
+	assert.InDelta(t, 2*idf(40, 1)/idf(10, 1), results[0].Value.docs[0].Score, 1e-5)
+	assert.InDelta(t, 3*idf(40, 3)/idf(30, 3), results[1].Value.docs[0].Score, 1e-5)
+}
+
+// memCompleter is a fake in-memory autocompleter, failing all its requests if err is set
+type memCompleter struct {
+	terms    []index.Suggestion
+	err      error
+	suggests int
+}
+
+func (m *memCompleter) AddTerms(terms ...index.Suggestion) error {
+	m.terms = append(m.terms, terms...)
+	return m.err
+}
+
+func (m *memCompleter) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
+	m.suggests++
+	ret := []index.Suggestion{}
+	for _, t := range m.terms {
+		if strings.HasPrefix(t.Term, prefix) {
+			ret = append(ret, t)
+		}
+	}
+	return ret, m.err
+}
+
+func (m *memCompleter) IncrTerms(terms ...index.Suggestion) error {
+	for _, t := range terms {
+		found := false
+		for n := range m.terms {
+			if m.terms[n].Term == t.Term {
+				m.terms[n].Score += t.Score
+				found = true
+			}
+		}
+		if !found {
+			m.terms = append(m.terms, t)
+		}
+	}
+	return m.err
+}
+
+func (m *memCompleter) DeleteTerms(terms ...string) (int, error) {
+	deleted := 0
+	for _, t := range terms {
+		for n := range m.terms {
+			if m.terms[n].Term == t {
+				m.terms = append(m.terms[:n], m.terms[n+1:]...)
+				deleted++
+				break
+			}
+		}
+	}
+	return deleted, m.err
+}
+
+func (m *memCompleter) Len() (int, error) {
+	return len(m.terms), m.err
+}
+
+func (m *memCompleter) Delete() error {
+	m.terms = nil
+	return m.err
+}
+
+func TestDistributedSuggest(t *testing.T) {
+	var completers []*memCompleter
+	newIdx := func(opts ...DistributedOption) *DistributedIndex {
+		completers = nil
+		return newDistributedIndex(4, func(n, r, _ int) (index.Index, index.Autocompleter) {
+			ac := &memCompleter{}
+			completers = append(completers, ac)
+			return nil, ac
+		}, append(opts, WithPartitioner(NewJumpPartitioner(4))))
+	}
+
+	terms := []index.Suggestion{
+		{Term: "hello", Score: 1}, {Term: "help", Score: 2}, {Term: "helium", Score: 2},
+		{Term: "world", Score: 3}, {Term: "he", Score: 5},
+	}
+
+	// prefix routing puts all the terms starting with "he" on one partition, which answers alone
+	idx := newIdx(WithPrefixRouting(2))
+	assert.NoError(t, idx.AddTerms(terms...))
+	suggs, err := idx.Suggest("hel", 10, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []index.Suggestion{{Term: "helium", Score: 2}, {Term: "help", Score: 2}, {Term: "hello", Score: 1}}, suggs)
+	asked := 0
+	for _, ac := range completers {
+		asked += ac.suggests
+	}
+	assert.Equal(t, 1, asked)
+
+	// deletes go to the partition of each term, and counts are summed over the partitions
+	assert.NoError(t, idx.IncrTerms(index.Suggestion{Term: "help", Score: 3}))
+	n, err := idx.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, len(terms), n)
+	n, err = idx.DeleteTerms("help", "world", "nosuchterm")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = idx.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, len(terms)-2, n)
+
+	// duplicates across partitions are merged, keeping the highest score
+	idx = newIdx()
+	completers[0].terms = []index.Suggestion{{Term: "hello", Score: 1}}
+	completers[1].terms = []index.Suggestion{{Term: "hello", Score: 4}, {Term: "help", Score: 2}}
+	suggs, err = idx.Suggest("he", 10, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []index.Suggestion{{Term: "hello", Score: 4}, {Term: "help", Score: 2}}, suggs)
+
+	// failing partitions are reported instead of dropped
+	completers[2].err = io.EOF
+	_, err = idx.Suggest("he", 10, false)
+	assert.Error(t, err)
+
+	idx.policy = BestEffort
+	suggs, err = idx.Suggest("he", 1, false)
+	assert.Equal(t, []index.Suggestion{{Term: "hello", Score: 4}}, suggs)
+	if assert.IsType(t, &PartialResultError{}, err) {
+		assert.Equal(t, []ShardError{{2, io.EOF}}, err.(*PartialResultError).Failed)
+	}
 }
@@ -0,0 +1,379 @@
+package redisearch
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/RedisLabs/RediSearchBenchmark/query"
+)
+
+// ReplicationMode decides which replicas of a partition documents are written to
+type ReplicationMode int
+
+const (
+	// WriteAllReplicas writes every document to all the replicas, each replica holding an independent index. A write
+	// fails if any replica fails it, so a single replica that is down fails all the writes to its partition
+	WriteAllReplicas ReplicationMode = iota
+
+	// WritePrimary writes documents to the first replica only, relying on redis replication to copy them to the others
+	WritePrimary
+)
+
+// ReplicaBalancer decides which replica of a partition serves a read
+type ReplicaBalancer int
+
+const (
+	// RoundRobin reads from the replicas in turn
+	RoundRobin ReplicaBalancer = iota
+
+	// LeastOutstanding reads from the replica with the fewest requests in flight
+	LeastOutstanding
+
+	// LatencyEWMA reads from the replica with the lowest moving average of latency, weighted by its requests in flight
+	LatencyEWMA
+)
+
+// defaultFailoverPeriod is how long a failed replica is skipped if the options don't say otherwise
+const defaultFailoverPeriod = time.Second
+
+// ewmaWeight is the weight of the latest latency in the moving average of a replica
+const ewmaWeight = 0.3
+
+// ReplicaOptions configure the replication of the partitions of a distributed index
+type ReplicaOptions struct {
+	// Replicas is the number of redis instances backing each partition. Replica r of partition n is on host
+	// n*Replicas+r, so that each partition has its own hosts when there are partitions*Replicas hosts
+	Replicas int
+	Mode     ReplicationMode
+	Balancer ReplicaBalancer
+	// FailoverPeriod is how long a replica failing with a connection error is skipped by reads. Default 1 second
+	FailoverPeriod time.Duration
+}
+
+// WithReplicas backs each partition with several redis instances
+func WithReplicas(opts ReplicaOptions) DistributedOption {
+	return func(i *DistributedIndex) {
+		i.replicas = opts
+	}
+}
+
+// replicaState is the load and health of a single replica, as seen by the balancer
+type replicaState struct {
+	outstanding int
+	ewma        float64
+	downUntil   time.Time
+}
+
+// replicaSet balances reads over the replicas of a partition, and skips replicas that are down
+type replicaSet struct {
+	mtx    sync.Mutex
+	opts   ReplicaOptions
+	states []replicaState
+	next   int
+}
+
+func newReplicaSet(opts ReplicaOptions) *replicaSet {
+	if opts.FailoverPeriod <= 0 {
+		opts.FailoverPeriod = defaultFailoverPeriod
+	}
+	return &replicaSet{
+		opts:   opts,
+		states: make([]replicaState, opts.Replicas),
+	}
+}
+
+// writeTargets returns the number of replicas writes are sent to, which are the first replicas
+func (s *replicaSet) writeTargets() int {
+	if s.opts.Mode == WritePrimary {
+		return 1
+	}
+	return len(s.states)
+}
+
+// write runs a write on the replicas it should go to in parallel, returning the first error
+func (s *replicaSet) write(f func(r int) error) error {
+	n := s.writeTargets()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for r := 0; r < n; r++ {
+		wg.Add(1)
+		go func(r int) {
+			errs[r] = f(r)
+			wg.Done()
+		}(r)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pick chooses the replica to read from among those not tried yet, preferring replicas that are up,
+// and marks a request to it as outstanding
+func (s *replicaSet) pick(tried []bool) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	best := -1
+	bestUp := false
+	var bestCost float64
+	start := s.next
+	s.next = (s.next + 1) % len(s.states)
+	for x := 0; x < len(s.states); x++ {
+		r := (start + x) % len(s.states)
+		if tried[r] {
+			continue
+		}
+		st := s.states[r]
+		up := !now.Before(st.downUntil)
+
+		var cost float64
+		switch s.opts.Balancer {
+		case LeastOutstanding:
+			cost = float64(st.outstanding)
+		case LatencyEWMA:
+			cost = st.ewma * float64(st.outstanding+1)
+		}
+		// with round robin all costs are equal, so the first replica from the rotating start wins
+		if best < 0 || (up && !bestUp) || (up == bestUp && cost < bestCost) {
+			best, bestUp, bestCost = r, up, cost
+		}
+	}
+	s.states[best].outstanding++
+	return best
+}
+
+// done records the outcome of a read from a replica, marking it down if it failed with a connection error
+func (s *replicaSet) done(r int, latency time.Duration, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	st := &s.states[r]
+	st.outstanding--
+	if err != nil {
+		if isTransient(err) {
+			st.downUntil = time.Now().Add(s.opts.FailoverPeriod)
+		}
+		return
+	}
+	if st.ewma == 0 {
+		st.ewma = float64(latency)
+	} else {
+		st.ewma += ewmaWeight * (float64(latency) - st.ewma)
+	}
+}
+
+// read runs a read on a replica chosen by the balancer, failing over to the other replicas on connection errors
+func (s *replicaSet) read(f func(r int) error) error {
+	tried := make([]bool, len(s.states))
+	var err error
+	for n := 0; n < len(s.states); n++ {
+		r := s.pick(tried)
+		tried[r] = true
+
+		st := time.Now()
+		err = f(r)
+		s.done(r, time.Since(st), err)
+		if err == nil || !isTransient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// replicatedIndex is the index of a partition backed by several replicas
+type replicatedIndex struct {
+	*replicaSet
+	replicas []index.Index
+}
+
+// Index writes the documents to the replicas according to the replication mode
+func (i *replicatedIndex) Index(docs []index.Document, options interface{}) error {
+	return i.write(func(r int) error {
+		return i.replicas[r].Index(docs, options)
+	})
+}
+
+// Search searches one of the replicas, chosen by the balancer
+func (i *replicatedIndex) Search(q query.Query) (docs []index.Document, total int, err error) {
+	err = i.read(func(r int) error {
+		var e error
+		docs, total, e = i.replicas[r].Search(q)
+		return e
+	})
+	return docs, total, err
+}
+
+// SearchTimed searches one of the replicas like Search, also returning the server side time of the search
+func (i *replicatedIndex) SearchTimed(q query.Query) (res index.SearchResponse, err error) {
+	err = i.read(func(r int) error {
+		var e error
+		res, e = searchTimed(i.replicas[r], q)
+		return e
+	})
+	return res, err
+}
+
+func (i *replicatedIndex) Refresh() error {
+	return nil
+}
+
+// Create creates the index on the replicas written to
+func (i *replicatedIndex) Create() error {
+	return i.write(func(r int) error {
+		return i.replicas[r].Create()
+	})
+}
+
+// Drop drops the index on the replicas written to
+func (i *replicatedIndex) Drop() error {
+	return i.write(func(r int) error {
+		return i.replicas[r].Drop()
+	})
+}
+
+// ScanDocuments reads all the documents of the partition from its first replica
+func (i *replicatedIndex) ScanDocuments(batch int, fn func([]index.Document) error) error {
+	return i.replicas[0].(migratable).ScanDocuments(batch, fn)
+}
+
+// DeleteDocuments deletes documents from the replicas written to
+func (i *replicatedIndex) DeleteDocuments(ids ...string) error {
+	return i.write(func(r int) error {
+		return i.replicas[r].(migratable).DeleteDocuments(ids...)
+	})
+}
+
+// DropIndex drops the index from the replicas written to
+func (i *replicatedIndex) DropIndex() error {
+	return i.write(func(r int) error {
+		return i.replicas[r].(migratable).DropIndex()
+	})
+}
+
+// TermStats returns the term statistics of one of the replicas, chosen by the balancer
+func (i *replicatedIndex) TermStats(terms ...string) (numDocs int, df map[string]int, err error) {
+	err = i.read(func(r int) error {
+		scorer, ok := i.replicas[r].(termScorer)
+		if !ok {
+			return errors.New("partition does not support global scoring")
+		}
+		var e error
+		numDocs, df, e = scorer.TermStats(terms...)
+		return e
+	})
+	return numDocs, df, err
+}
+
+// TermScores returns the per term scores of documents from one of the replicas, chosen by the balancer
+func (i *replicatedIndex) TermScores(ids []string, terms ...string) (scores map[string]map[string]float64, err error) {
+	err = i.read(func(r int) error {
+		scorer, ok := i.replicas[r].(termScorer)
+		if !ok {
+			return errors.New("partition does not support global scoring")
+		}
+		var e error
+		scores, e = scorer.TermScores(ids, terms...)
+		return e
+	})
+	return scores, err
+}
+
+// SpellCheck spell checks a query on one of the replicas, chosen by the balancer
+func (i *replicatedIndex) SpellCheck(q string, opts SpellCheckOptions) (terms []MisspelledTerm, err error) {
+	err = i.read(func(r int) error {
+		sc, ok := i.replicas[r].(spellChecker)
+		if !ok {
+			return errors.New("partition does not support spellcheck")
+		}
+		var e error
+		terms, e = sc.SpellCheck(q, opts)
+		return e
+	})
+	return terms, err
+}
+
+// LoadDictionary loads a custom dictionary on the replicas written to
+func (i *replicatedIndex) LoadDictionary(dict, fileName string) error {
+	return i.write(func(r int) error {
+		sc, ok := i.replicas[r].(spellChecker)
+		if !ok {
+			return errors.New("partition does not support spellcheck")
+		}
+		return sc.LoadDictionary(dict, fileName)
+	})
+}
+
+// LoadSynonyms loads synonym groups on the replicas written to
+func (i *replicatedIndex) LoadSynonyms(fileName string) error {
+	return i.write(func(r int) error {
+		sc, ok := i.replicas[r].(spellChecker)
+		if !ok {
+			return errors.New("partition does not support synonyms")
+		}
+		return sc.LoadSynonyms(fileName)
+	})
+}
+
+// replicatedCompleter is the autocompleter of a partition backed by several replicas
+type replicatedCompleter struct {
+	*replicaSet
+	replicas []index.Autocompleter
+}
+
+// AddTerms adds the terms to the replicas according to the replication mode
+func (a *replicatedCompleter) AddTerms(terms ...index.Suggestion) error {
+	return a.write(func(r int) error {
+		return a.replicas[r].AddTerms(terms...)
+	})
+}
+
+// IncrTerms increments the terms on the replicas according to the replication mode
+func (a *replicatedCompleter) IncrTerms(terms ...index.Suggestion) error {
+	return a.write(func(r int) error {
+		return a.replicas[r].IncrTerms(terms...)
+	})
+}
+
+// DeleteTerms deletes the terms from the replicas written to, returning the number deleted from the first one
+func (a *replicatedCompleter) DeleteTerms(terms ...string) (int, error) {
+	counts := make([]int, a.writeTargets())
+	err := a.write(func(r int) (err error) {
+		counts[r], err = a.replicas[r].DeleteTerms(terms...)
+		return err
+	})
+	return counts[0], err
+}
+
+// Len returns the number of suggestions of one of the replicas, chosen by the balancer
+func (a *replicatedCompleter) Len() (n int, err error) {
+	err = a.read(func(r int) error {
+		var e error
+		n, e = a.replicas[r].Len()
+		return e
+	})
+	return n, err
+}
+
+// Suggest gets suggestions from one of the replicas, chosen by the balancer
+func (a *replicatedCompleter) Suggest(prefix string, num int, fuzzy bool) (ret []index.Suggestion, err error) {
+	err = a.read(func(r int) error {
+		var e error
+		ret, e = a.replicas[r].Suggest(prefix, num, fuzzy)
+		return e
+	})
+	return ret, err
+}
+
+// Delete deletes the autocompleter from the replicas written to
+func (a *replicatedCompleter) Delete() error {
+	return a.write(func(r int) error {
+		return a.replicas[r].Delete()
+	})
+}
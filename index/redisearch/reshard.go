@@ -0,0 +1,155 @@
+package redisearch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// reshardBatch is the number of documents read from a partition at once when resharding
+const reshardBatch = 500
+
+// migratable is implemented by partitions whose documents can be moved to other partitions
+type migratable interface {
+	ScanDocuments(batch int, fn func([]index.Document) error) error
+	DeleteDocuments(ids ...string) error
+	DropIndex() error
+}
+
+// ReshardProgress reports the progress of a resharding after each migrated batch of documents
+type ReshardProgress struct {
+	// the old partition currently being migrated, and the number of old partitions
+	Partition     int
+	NumPartitions int
+	// documents scanned and moved so far, over all partitions
+	Scanned int
+	Moved   int
+}
+
+// Reshard changes the number of partitions of the index online, moving documents to their partition according to
+// the new partitioner. New partitions are created first, then the documents of every old partition are read back,
+// written to their new partition and deleted from the old one. Partitions no longer needed are dropped at the end.
+//
+// Searches keep being served during the migration, reading from both old and new partitions and returning documents
+// found on both only once. Documents indexed during the migration are written to the new layout. If progress is not
+// nil, it is called after each migrated batch.
+//
+// Suggestions can't be read back from the autocompleters, so they are not migrated: they keep being added, found and
+// deleted with the autocompleters and partitioner the index was created with, whose keys are kept when partitions
+// are dropped.
+//
+// If the migration fails part-way, the index is left with the new partitioner over both the old and new partitions,
+// some documents not moved yet. They are still found by searches, but documents written to both layouts may be found
+// twice. Running Reshard again with the same arguments finishes the migration.
+//
+// The migration doesn't stop writes, which has two limits. A document updated while its old copy is still on its old
+// partition may be overwritten by that stale copy when it is moved. And on LegacyMode partitions, which are scanned by
+// paging through a wildcard query, documents written to an old partition during its scan shift the pages, so that some
+// documents may be missed and stay on their old partition. Writes should be paused for an exact migration
+func (i *DistributedIndex) Reshard(partitions int, part Partitioner, progress func(ReshardProgress)) error {
+	if partitions <= 0 {
+		return errors.New("invalid number of partitions")
+	}
+	if err := checkPartitioner(part, partitions); err != nil {
+		return err
+	}
+
+	// only the migrating flag is set under the layout lock, so that searches and writes aren't blocked while the new
+	// partitions are created
+	i.mtx.Lock()
+	if i.migrating {
+		i.mtx.Unlock()
+		return errors.New("resharding already in progress")
+	}
+	old := i.partitions
+	i.migrating = true
+	i.mtx.Unlock()
+
+	// create the new partitions, and serve reads from the union of old and new partitions until we are done
+	subs := append([]index.Index{}, old...)
+	for n := len(old); n < partitions; n++ {
+		sub, _ := i.buildPartition(n)
+		if err := sub.Create(); err != nil {
+			i.mtx.Lock()
+			i.migrating = false
+			i.mtx.Unlock()
+			return err
+		}
+		subs = append(subs, sub)
+	}
+
+	i.mtx.Lock()
+	i.partitions = subs
+	i.part = part
+	i.mtx.Unlock()
+
+	st := ReshardProgress{NumPartitions: len(old)}
+	var err error
+	for n := 0; n < len(old) && err == nil; n++ {
+		st.Partition = n
+		err = i.migratePartition(n, subs, part, &st, progress)
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	i.migrating = false
+	if err != nil {
+		return err
+	}
+
+	// drop the partitions we no longer need
+	for n := partitions; n < len(subs); n++ {
+		if sub, ok := subs[n].(migratable); ok {
+			if err := sub.DropIndex(); err != nil {
+				return err
+			}
+		}
+	}
+	i.partitions = subs[:partitions]
+	return nil
+}
+
+// migratePartition moves the documents of partition n that belong elsewhere according to the partitioner
+func (i *DistributedIndex) migratePartition(n int, subs []index.Index, part Partitioner, st *ReshardProgress,
+	progress func(ReshardProgress)) error {
+
+	src, ok := subs[n].(migratable)
+	if !ok {
+		return fmt.Errorf("partition %d does not support resharding", n)
+	}
+
+	return src.ScanDocuments(reshardBatch, func(docs []index.Document) error {
+		st.Scanned += len(docs)
+
+		moves := make(map[uint32][]index.Document)
+		for _, d := range docs {
+			if p := partitionForDocument(part, d); int(p) != n {
+				moves[p] = append(moves[p], d)
+			}
+		}
+
+		// write the documents to their new partition before deleting them, so they are always searchable
+		for p, moved := range moves {
+			if int(p) >= len(subs) {
+				return fmt.Errorf("partitioner returned invalid partition %d", p)
+			}
+			if err := subs[p].Index(moved, nil); err != nil {
+				return err
+			}
+			ids := make([]string, 0, len(moved))
+			for _, d := range moved {
+				ids = append(ids, d.Id)
+			}
+			if err := src.DeleteDocuments(ids...); err != nil {
+				return err
+			}
+			st.Moved += len(moved)
+		}
+
+		if progress != nil {
+			progress(*st)
+		}
+		return nil
+	})
+}
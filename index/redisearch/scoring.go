@@ -0,0 +1,226 @@
+package redisearch
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/garyburd/redigo/redis"
+)
+
+// globalScoringOverfetch is how many more candidates each partition returns when results are rescored with global
+// term statistics, since documents just below the local top results may make it to the global top results
+const globalScoringOverfetch = 2
+
+// WithGlobalScoring scores search results with term statistics of the whole index instead of those of each partition,
+// so that rankings come closer to those of a single index. Each partition returns its term statistics along with its
+// results, which are then rescored centrally. This costs two extra round trips per partition, for the term statistics
+// and the per term scores of its results. Only the top globalScoringOverfetch*num results of each partition are
+// rescored, so a document ranked lower by its partition is missed even if its global score would make the top results
+func WithGlobalScoring() DistributedOption {
+	return func(i *DistributedIndex) {
+		i.globalScoring = true
+	}
+}
+
+// termScorer is implemented by partitions that can return their term statistics, for global scoring
+type termScorer interface {
+	TermStats(terms ...string) (numDocs int, df map[string]int, err error)
+	TermScores(ids []string, terms ...string) (map[string]map[string]float64, error)
+}
+
+// queryTerms splits a query into its distinct lowercase terms, ignoring the query syntax
+func queryTerms(q string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, t := range strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// idf computes the inverse document frequency of a term like the default TFIDF scorer of RediSearch, which takes the
+// binary exponent of 1+numDocs/df with logb, not its logarithm. It is at least 1 as df is at most numDocs, which may
+// lag behind when documents are being indexed. Queries don't select another scorer, so rescoring assumes TFIDF
+func idf(numDocs, df int) float64 {
+	if df == 0 {
+		df = 1
+	}
+	if numDocs < df {
+		numDocs = df
+	}
+	return math.Logb(1 + float64(numDocs)/float64(df))
+}
+
+// TermStats returns the number of documents in the index, and the number of documents containing each term
+func (i *Index) TermStats(terms ...string) (numDocs int, df map[string]int, err error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	if err := conn.Send(i.commandPrefix+".INFO", i.name); err != nil {
+		return 0, nil, err
+	}
+	for _, t := range terms {
+		if err := conn.Send(i.commandPrefix+".SEARCH", i.name, t, "VERBATIM", "LIMIT", 0, 0); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return 0, nil, err
+	}
+
+	info, err := redis.Values(conn.Receive())
+	if err != nil {
+		return 0, nil, err
+	}
+	for n := 0; n+1 < len(info); n += 2 {
+		if k, _ := redis.String(info[n], nil); k == "num_docs" {
+			numDocs, err = redis.Int(info[n+1], nil)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+
+	df = make(map[string]int, len(terms))
+	for _, t := range terms {
+		res, err := redis.Values(conn.Receive())
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(res) == 0 {
+			return 0, nil, errors.New("empty search reply")
+		}
+		if df[t], err = redis.Int(res[0], nil); err != nil {
+			return 0, nil, err
+		}
+	}
+	return numDocs, df, nil
+}
+
+// TermScores returns the scores of the given documents for single term queries, mapping each term to the scores
+// of the documents containing it
+func (i *Index) TermScores(ids []string, terms ...string) (map[string]map[string]float64, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	keys := make([]string, len(ids))
+	for n, id := range ids {
+		keys[n] = id
+		if i.mode != LegacyMode {
+			keys[n] = i.keyPrefix + id
+		}
+	}
+
+	for _, t := range terms {
+		args := redis.Args{i.name, t, "VERBATIM", "INKEYS", len(keys)}.AddFlat(keys)
+		args = append(args, "NOCONTENT", "WITHSCORES", "LIMIT", 0, len(keys))
+		if err := conn.Send(i.commandPrefix+".SEARCH", args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]map[string]float64, len(terms))
+	for _, t := range terms {
+		res, err := redis.Values(conn.Receive())
+		if err != nil {
+			return nil, err
+		}
+		// the reply is of the form [total, id, score, id, score...]
+		scores := make(map[string]float64, len(res)/2)
+		for n := 1; n+1 < len(res); n += 2 {
+			id, err := redis.String(res[n], nil)
+			if err != nil {
+				return nil, err
+			}
+			score, err := redis.Float64(res[n+1], nil)
+			if err != nil {
+				return nil, err
+			}
+			scores[strings.TrimPrefix(id, i.keyPrefix)] = score
+		}
+		ret[t] = scores
+	}
+	return ret, nil
+}
+
+// partitionTerms are the term statistics of a partition, and the scores of its results for each query term
+type partitionTerms struct {
+	numDocs int
+	df      map[string]int
+	scores  map[string]map[string]float64
+}
+
+// loadPartitionTerms reads the term statistics of a partition, and the per term scores of the documents it returned
+func loadPartitionTerms(sub index.Index, terms []string, docs []index.Document) (*partitionTerms, error) {
+	scorer, ok := sub.(termScorer)
+	if !ok {
+		return nil, errors.New("partition does not support global scoring")
+	}
+	numDocs, df, err := scorer.TermStats(terms...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(docs))
+	for n, d := range docs {
+		ids[n] = d.Id
+	}
+	found := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if df[t] > 0 {
+			found = append(found, t)
+		}
+	}
+	pt := &partitionTerms{numDocs: numDocs, df: df, scores: map[string]map[string]float64{}}
+	if len(ids) > 0 && len(found) > 0 {
+		if pt.scores, err = scorer.TermScores(ids, found...); err != nil {
+			return nil, err
+		}
+	}
+	return pt, nil
+}
+
+// rescore replaces the scores of the documents returned by the partitions with scores based on global term
+// statistics. The score of a document is the sum of its single term scores, each term's inverse document frequency
+// on the partition being replaced with its frequency over all partitions
+func rescore(results []taskResult[searchResult], terms []string) {
+	numDocs := 0
+	df := make(map[string]int, len(terms))
+	for _, r := range results {
+		if r.Err != nil || r.Value.terms == nil {
+			continue
+		}
+		numDocs += r.Value.terms.numDocs
+		for _, t := range terms {
+			df[t] += r.Value.terms.df[t]
+		}
+	}
+
+	for _, r := range results {
+		pt := r.Value.terms
+		if r.Err != nil || pt == nil {
+			continue
+		}
+		for n := range r.Value.docs {
+			d := &r.Value.docs[n]
+			score := 0.0
+			for _, t := range terms {
+				if s, ok := pt.scores[t][d.Id]; ok {
+					score += s * idf(numDocs, df[t]) / idf(pt.numDocs, pt.df[t])
+				}
+			}
+			d.Score = float32(score)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package redisearch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/garyburd/redigo/redis"
+)
+
+// SpellCheckOptions are the options of a spellcheck request
+type SpellCheckOptions struct {
+	// the maximal Levenshtein distance of suggestions, 1 to 4. 0 uses the server default
+	Distance int
+	// custom dictionaries whose terms are suggested as well
+	Include []string
+	// custom dictionaries whose terms are never reported as misspelled
+	Exclude []string
+}
+
+// MisspelledTerm is a query term that was not found in the index, along with its suggested corrections
+type MisspelledTerm struct {
+	Term        string
+	Suggestions []index.Suggestion
+}
+
+// SpellCheck checks the terms of a query against the index and the included dictionaries,
+// returning suggested corrections for every misspelled term
+func (i *Index) SpellCheck(q string, opts SpellCheckOptions) ([]MisspelledTerm, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	args := redis.Args{i.name, q}
+	if opts.Distance > 0 {
+		args = append(args, "DISTANCE", opts.Distance)
+	}
+	for _, d := range opts.Include {
+		args = append(args, "TERMS", "INCLUDE", d)
+	}
+	for _, d := range opts.Exclude {
+		args = append(args, "TERMS", "EXCLUDE", d)
+	}
+
+	res, err := redis.Values(conn.Do(i.commandPrefix+".SPELLCHECK", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]MisspelledTerm, 0, len(res))
+	for _, r := range res {
+		// each entry is of the form ["TERM", term, [[score, suggestion], ...]]
+		entry, err := redis.Values(r, nil)
+		if err != nil || len(entry) != 3 {
+			return nil, fmt.Errorf("invalid spellcheck reply %v", r)
+		}
+		term, err := redis.String(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		suggs, err := redis.Values(entry[2], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		mt := MisspelledTerm{Term: term, Suggestions: make([]index.Suggestion, 0, len(suggs))}
+		for _, s := range suggs {
+			pair, err := redis.Strings(s, nil)
+			if err != nil || len(pair) != 2 {
+				continue
+			}
+			score, err := strconv.ParseFloat(pair[0], 64)
+			if err != nil {
+				continue
+			}
+			mt.Suggestions = append(mt.Suggestions, index.Suggestion{Term: pair[1], Score: score})
+		}
+		ret = append(ret, mt)
+	}
+	return ret, nil
+}
+
+// DictAdd adds terms to a custom dictionary, returning the number of new terms
+func (i *Index) DictAdd(dict string, terms ...string) (int, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	return redis.Int(conn.Do(i.commandPrefix+".DICTADD", redis.Args{dict}.AddFlat(terms)...))
+}
+
+// DictDel deletes terms from a custom dictionary, returning the number of deleted terms
+func (i *Index) DictDel(dict string, terms ...string) (int, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	return redis.Int(conn.Do(i.commandPrefix+".DICTDEL", redis.Args{dict}.AddFlat(terms)...))
+}
+
+// DictDump returns all the terms of a custom dictionary
+func (i *Index) DictDump(dict string) ([]string, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	return redis.Strings(conn.Do(i.commandPrefix+".DICTDUMP", dict))
+}
+
+// SynUpdate adds terms to a synonym group, creating it if needed
+func (i *Index) SynUpdate(group string, terms ...string) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do(i.commandPrefix+".SYNUPDATE", redis.Args{i.name, group}.AddFlat(terms)...)
+	return err
+}
+
+// SynDump returns the synonym groups of the index, mapping each term to the groups it belongs to
+func (i *Index) SynDump() (map[string][]string, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+
+	res, err := redis.Values(conn.Do(i.commandPrefix+".SYNDUMP", i.name))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string][]string, len(res)/2)
+	for n := 0; n+1 < len(res); n += 2 {
+		term, err := redis.String(res[n], nil)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := redis.Strings(res[n+1], nil)
+		if err != nil {
+			return nil, err
+		}
+		ret[term] = groups
+	}
+	return ret, nil
+}
+
+// readLines reads the non empty, trimmed lines of a file
+func readLines(fileName string) ([]string, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// LoadSynonyms loads synonym groups from a file with one group of comma separated terms per line.
+// Groups are identified by their line number
+func (i *Index) LoadSynonyms(fileName string) error {
+	lines, err := readLines(fileName)
+	if err != nil {
+		return err
+	}
+
+	for n, line := range lines {
+		terms := []string{}
+		for _, t := range strings.Split(line, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				terms = append(terms, t)
+			}
+		}
+		if len(terms) < 2 {
+			continue
+		}
+		if err := i.SynUpdate(strconv.Itoa(n), terms...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDictionary adds the terms of a file with one term per line to a custom dictionary
+func (i *Index) LoadDictionary(dict, fileName string) error {
+	terms, err := readLines(fileName)
+	if err != nil {
+		return err
+	}
+
+	// add the terms in chunks, to avoid huge commands
+	const chunk = 1000
+	for len(terms) > 0 {
+		n := chunk
+		if n > len(terms) {
+			n = len(terms)
+		}
+		if _, err := i.DictAdd(dict, terms[:n]...); err != nil {
+			return err
+		}
+		terms = terms[n:]
+	}
+	return nil
+}
+
+// spellChecker is implemented by the partitions of a distributed index that support spell checking and synonyms
+type spellChecker interface {
+	SpellCheck(q string, opts SpellCheckOptions) ([]MisspelledTerm, error)
+	LoadDictionary(dict, fileName string) error
+	LoadSynonyms(fileName string) error
+}
+
+// spellCheckers returns the partitions of the index as spell checkers
+func (i *DistributedIndex) spellCheckers() ([]spellChecker, error) {
+	partitions, _, _ := i.layout()
+	ret := make([]spellChecker, 0, len(partitions))
+	for n, p := range partitions {
+		sc, ok := p.(spellChecker)
+		if !ok {
+			return nil, fmt.Errorf("partition %d does not support spellcheck", n)
+		}
+		ret = append(ret, sc)
+	}
+	return ret, nil
+}
+
+// SpellCheck checks the terms of a query on all the partitions. A term is misspelled if no partition has it, and its
+// suggestions are those of all the partitions, keeping the highest score of suggestions found on several of them.
+// Spell checking fails if any partition fails or times out
+func (i *DistributedIndex) SpellCheck(q string, opts SpellCheckOptions) ([]MisspelledTerm, error) {
+	scs, err := i.spellCheckers()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+
+	tg := newTaskGroup[[]MisspelledTerm](ctx, i.exec, len(scs))
+	for n := range scs {
+		n := n
+		err := tg.Submit(n, func(context.Context) ([]MisspelledTerm, error) {
+			return scs[n].SpellCheck(q, opts)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	results, err := tg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			return nil, fmt.Errorf("partition %d failed: %s", r.Id, r.Err)
+		}
+	}
+	return mergeMisspelledTerms(results), nil
+}
+
+// mergeMisspelledTerms keeps the terms misspelled on all partitions, in query order, merging their suggestions best
+// first
+func mergeMisspelledTerms(rs []taskResult[[]MisspelledTerm]) []MisspelledTerm {
+	sort.Slice(rs, func(a, b int) bool {
+		return rs[a].Id < rs[b].Id
+	})
+
+	order := []string{}
+	found := map[string]int{}
+	best := map[string]map[string]index.Suggestion{}
+	for _, r := range rs {
+		for _, mt := range r.Value {
+			if found[mt.Term] == 0 {
+				order = append(order, mt.Term)
+				best[mt.Term] = map[string]index.Suggestion{}
+			}
+			found[mt.Term]++
+			for _, s := range mt.Suggestions {
+				if cur, ok := best[mt.Term][s.Term]; !ok || s.Score > cur.Score {
+					best[mt.Term][s.Term] = s
+				}
+			}
+		}
+	}
+
+	ret := make([]MisspelledTerm, 0, len(order))
+	for _, term := range order {
+		// a partition not reporting the term has it in its index
+		if found[term] < len(rs) {
+			continue
+		}
+		mt := MisspelledTerm{Term: term, Suggestions: make([]index.Suggestion, 0, len(best[term]))}
+		for _, s := range best[term] {
+			mt.Suggestions = append(mt.Suggestions, s)
+		}
+		sort.Slice(mt.Suggestions, func(a, b int) bool {
+			if mt.Suggestions[a].Score != mt.Suggestions[b].Score {
+				return mt.Suggestions[a].Score > mt.Suggestions[b].Score
+			}
+			return mt.Suggestions[a].Term < mt.Suggestions[b].Term
+		})
+		ret = append(ret, mt)
+	}
+	return ret
+}
+
+// LoadDictionary adds the terms of a file with one term per line to a custom dictionary on the hosts of all the
+// partitions
+func (i *DistributedIndex) LoadDictionary(dict, fileName string) error {
+	scs, err := i.spellCheckers()
+	if err != nil {
+		return err
+	}
+	for _, sc := range scs {
+		if err := sc.LoadDictionary(dict, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadSynonyms loads synonym groups from a file with one group of comma separated terms per line on all the
+// partitions
+func (i *DistributedIndex) LoadSynonyms(fileName string) error {
+	scs, err := i.spellCheckers()
+	if err != nil {
+		return err
+	}
+	for _, sc := range scs {
+		if err := sc.LoadSynonyms(fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
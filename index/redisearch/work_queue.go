@@ -1,72 +1,200 @@
 package redisearch
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type resultChan chan interface{}
+// errShutdown is returned when submitting tasks to an executor that was shut down
+var errShutdown = errors.New("executor is shut down")
 
-type workUnit struct {
-	f   func(interface{}) interface{}
-	v   interface{}
-	out resultChan
+// errGroupFull is returned when submitting more tasks to a task group than it was created for
+var errGroupFull = errors.New("task group is full")
+
+// ExecutorStats are the metrics of the executor running the shard requests of a distributed index
+type ExecutorStats struct {
+	// QueueDepth is the number of tasks currently waiting for a worker
+	QueueDepth int64
+	// Tasks is the number of tasks started so far, TotalWait and MaxWait the time they waited for a worker
+	Tasks     uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
 }
 
-type workQueue chan workUnit
+// AvgWait returns the average time tasks waited for a worker
+func (s ExecutorStats) AvgWait() time.Duration {
+	if s.Tasks == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Tasks)
+}
+
+// task is a unit of work queued on an executor
+type task struct {
+	run    func()
+	queued time.Time
+}
 
-func (wq workQueue) poolWorker() {
+// executor runs tasks on a fixed number of workers, until it is shut down
+type executor struct {
+	// the metrics are updated atomically, and are kept first for 64 bit alignment
+	tasks     uint64
+	totalWait int64
+	maxWait   int64
+	depth     int64
 
-	for work := range wq {
-		work.out <- work.f(work.v)
+	queue    chan task
+	quit     chan struct{}
+	shutdown sync.Once
+	wg       sync.WaitGroup
+}
+
+// newExecutor creates an executor with the given number of workers
+func newExecutor(workers int) *executor {
+	e := &executor{
+		queue: make(chan task),
+		quit:  make(chan struct{}),
 	}
+	e.wg.Add(workers)
+	for n := 0; n < workers; n++ {
+		go e.worker()
+	}
+	return e
 }
 
-// newWorkQueue creates a new workQueue with N workers
-func newWorkQueue(numWorkers int) workQueue {
-	wc := make(workQueue)
-	for i := 0; i < numWorkers; i++ {
-		go wc.poolWorker()
+func (e *executor) worker() {
+	defer e.wg.Done()
+	for {
+		select {
+		case t := <-e.queue:
+			e.recordWait(time.Since(t.queued))
+			t.run()
+		case <-e.quit:
+			return
+		}
+	}
+}
 
+// recordWait records the time a task waited for a worker
+func (e *executor) recordWait(wait time.Duration) {
+	atomic.AddUint64(&e.tasks, 1)
+	atomic.AddInt64(&e.totalWait, int64(wait))
+	for {
+		max := atomic.LoadInt64(&e.maxWait)
+		if int64(wait) <= max || atomic.CompareAndSwapInt64(&e.maxWait, max, int64(wait)) {
+			return
+		}
 	}
-	return wc
 }
 
-func (wq workQueue) NewTaskGroup() *taskGroup {
-	return &taskGroup{
-		wq:  wq,
-		rc:  make(resultChan, 8),
-		num: 0,
+// submit queues a function, blocking until a worker takes it, the context is done or the executor is shut down
+func (e *executor) submit(ctx context.Context, run func()) error {
+	atomic.AddInt64(&e.depth, 1)
+	defer atomic.AddInt64(&e.depth, -1)
+
+	select {
+	case e.queue <- task{run, time.Now()}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-e.quit:
+		return errShutdown
 	}
 }
 
-type taskGroup struct {
-	wq  workQueue
-	rc  resultChan
-	num int
+// Shutdown stops the workers once they finish their current task. Tasks submitted afterwards fail with errShutdown
+func (e *executor) Shutdown() {
+	e.shutdown.Do(func() {
+		close(e.quit)
+	})
+	e.wg.Wait()
 }
 
-func (t *taskGroup) Submit(f func(interface{}) interface{}, v interface{}) {
-	t.wq <- workUnit{f, v, t.rc}
-	t.num++
+// Stats returns the current metrics of the executor
+func (e *executor) Stats() ExecutorStats {
+	return ExecutorStats{
+		QueueDepth: atomic.LoadInt64(&e.depth),
+		Tasks:      atomic.LoadUint64(&e.tasks),
+		TotalWait:  time.Duration(atomic.LoadInt64(&e.totalWait)),
+		MaxWait:    time.Duration(atomic.LoadInt64(&e.maxWait)),
+	}
 }
-func (t *taskGroup) Wait(timeout time.Duration) ([]interface{}, error) {
-	returns := 0
-	//end := time.Now().Add(timeout)
-	ret := make([]interface{}, 0, t.num)
-	var err error
 
-	for returns < t.num { // && time.Now().Before(end) {
+// taskResult is the outcome of a single task of a group. Id is the id the task was submitted with, set even if the
+// task was skipped
+type taskResult[T any] struct {
+	Id    int
+	Value T
+	Err   error
+}
 
-		var res interface{}
+// taskGroup runs a group of tasks on an executor and collects their results
+type taskGroup[T any] struct {
+	ctx     context.Context
+	e       *executor
+	results chan taskResult[T]
+	num     int
+}
+
+// newTaskGroup creates a group of up to size tasks, cancelled when ctx is done. Its result channel holds all their
+// results, so tasks finishing after Wait returned don't block their workers
+func newTaskGroup[T any](ctx context.Context, e *executor, size int) *taskGroup[T] {
+	return &taskGroup[T]{
+		ctx:     ctx,
+		e:       e,
+		results: make(chan taskResult[T], size),
+	}
+}
+
+// Submit queues a task of the group with the given id, e.g. the partition it runs on. Tasks that didn't start before
+// the group is cancelled are skipped
+func (g *taskGroup[T]) Submit(id int, f func(ctx context.Context) (T, error)) error {
+	if g.num == cap(g.results) {
+		return errGroupFull
+	}
+
+	err := g.e.submit(g.ctx, func() {
+		res := taskResult[T]{Id: id}
+		if res.Err = g.ctx.Err(); res.Err == nil {
+			res.Value, res.Err = f(g.ctx)
+		}
+		g.results <- res
+	})
+	if err != nil {
+		return err
+	}
+	g.num++
+	return nil
+}
+
+// Wait waits for the results of all submitted tasks. If the group is cancelled first, the results returned so far
+// are returned along with the context's error
+func (g *taskGroup[T]) Wait() ([]taskResult[T], error) {
+	ret := make([]taskResult[T], 0, g.num)
+	for len(ret) < g.num {
 		select {
-		case res = <-t.rc:
+		case res := <-g.results:
 			ret = append(ret, res)
-			returns++
-			//		case <-time.After(end.Sub(time.Now())):
-			//			goto endit
+		case <-g.ctx.Done():
+			// select picks either case when both are ready, so collect the results already sent
+			return g.drain(ret), g.ctx.Err()
 		}
-
 	}
+	return ret, nil
+}
 
-	return ret, err
+// drain appends the results waiting in the result channel to ret, without blocking
+func (g *taskGroup[T]) drain(ret []taskResult[T]) []taskResult[T] {
+	for len(ret) < g.num {
+		select {
+		case res := <-g.results:
+			ret = append(ret, res)
+		default:
+			return ret
+		}
+	}
+	return ret
 }
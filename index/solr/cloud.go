@@ -0,0 +1,212 @@
+package solr
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// indexConfig and suggestConfig are the configsets of the index and suggestion collections
+//
+//go:embed solrconfig.xml managed-schema
+var indexConfig embed.FS
+
+//go:embed suggest
+var suggestConfig embed.FS
+
+// libDirective matches the <lib> directives of solrconfig.xml. Configsets uploaded without authentication are
+// untrusted and can't load libraries, which are only needed by handlers we don't use
+var libDirective = regexp.MustCompile(`(?s)\s*<lib [^>]*/>`)
+
+// coreIndex names the embedded Index of a CloudIndex, whose field would otherwise hide the promoted Index method
+type coreIndex = Index
+
+// CloudIndex is an index on a SolrCloud collection, sharded and replicated by solr. Documents, searches and
+// suggestions can be sent to any node, which routes them to the shards of the collection
+type CloudIndex struct {
+	*coreIndex
+	url      string
+	shards   int
+	replicas int
+	client   *http.Client
+}
+
+// NewCloudIndex creates a new SolrCloud index for the given solr url and collection name, with the given number of
+// shards and replicas of each shard. Its suggestions are in a single shard collection named after the index with a
+// "_suggest" suffix
+func NewCloudIndex(url, name string, md *index.Metadata, shards, replicas int) (*CloudIndex, error) {
+	idx, err := NewIndex(url, name, md)
+	if err != nil {
+		return nil, err
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &CloudIndex{
+		coreIndex: idx,
+		url:       strings.TrimSuffix(url, "/"),
+		shards:    shards,
+		replicas:  replicas,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// configSetName returns the name of the configset of a collection
+func configSetName(collection string) string {
+	return collection + "_config"
+}
+
+// collection is a collection of the index, with its configset and number of shards
+type collection struct {
+	name   string
+	config fs.FS
+	shards int
+}
+
+// collections returns the collections of the index. Suggestions are kept on a single shard, so that the suggest
+// dictionaries and real time gets don't need to be distributed
+func (c *CloudIndex) collections() ([]collection, error) {
+	suggest, err := fs.Sub(suggestConfig, "suggest")
+	if err != nil {
+		return nil, err
+	}
+	return []collection{
+		{name: c.name, config: indexConfig, shards: c.shards},
+		{name: c.name + suggestCoreSuffix, config: suggest, shards: 1},
+	}, nil
+}
+
+// Create uploads the configsets and creates the collections of the index, then adds the metadata's fields to the
+// schema of the index collection
+func (c *CloudIndex) Create() error {
+	colls, err := c.collections()
+	if err != nil {
+		return err
+	}
+	for _, coll := range colls {
+		cs, err := zipConfigSet(coll.config)
+		if err != nil {
+			return err
+		}
+		params := url.Values{"action": {"UPLOAD"}, "name": {configSetName(coll.name)}}
+		if err := c.admin("configs", params, cs); err != nil {
+			return err
+		}
+
+		params = url.Values{
+			"action":                {"CREATE"},
+			"name":                  {coll.name},
+			"numShards":             {strconv.Itoa(coll.shards)},
+			"replicationFactor":     {strconv.Itoa(c.replicas)},
+			"collection.configName": {configSetName(coll.name)},
+			// let several shards be placed on the same node, e.g. a single node benchmark
+			"maxShardsPerNode": {"-1"},
+		}
+		if err := c.admin("collections", params, nil); err != nil {
+			return err
+		}
+	}
+	return c.createFields()
+}
+
+// Drop deletes the collections of the index and their configsets
+func (c *CloudIndex) Drop() error {
+	colls, err := c.collections()
+	if err != nil {
+		return err
+	}
+	// deleted one by one, ignoring the collections and configsets that don't exist
+	for _, coll := range colls {
+		c.admin("collections", url.Values{"action": {"DELETE"}, "name": {coll.name}}, nil)
+		c.admin("configs", url.Values{"action": {"DELETE"}, "name": {configSetName(coll.name)}}, nil)
+	}
+	return nil
+}
+
+// adminResponse parses the responses of the collections and configsets APIs
+type adminResponse struct {
+	ResponseHeader struct {
+		Status int `json:"status"`
+	} `json:"responseHeader"`
+	Error struct {
+		Msg string `json:"msg"`
+	} `json:"error"`
+	// Failure holds the errors of the nodes that failed to run a collection command
+	Failure map[string]interface{} `json:"failure"`
+}
+
+// admin sends a request to one of the admin APIs, posting the body if there is one
+func (c *CloudIndex) admin(api string, params url.Values, body []byte) error {
+	params.Set("wt", "json")
+	u := fmt.Sprintf("%s/admin/%s?%s", c.url, api, params.Encode())
+
+	var res *http.Response
+	var err error
+	if body != nil {
+		res, err = c.client.Post(u, "application/octet-stream", bytes.NewReader(body))
+	} else {
+		res, err = c.client.Get(u)
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var r adminResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil && res.StatusCode == http.StatusOK {
+		return err
+	}
+	if res.StatusCode != http.StatusOK || r.ResponseHeader.Status != 0 || len(r.Failure) > 0 {
+		msg := r.Error.Msg
+		if msg == "" && len(r.Failure) > 0 {
+			msg = fmt.Sprint(r.Failure)
+		}
+		return fmt.Errorf("%s %s %s failed: %d %s", api, params.Get("action"), params.Get("name"), res.StatusCode, msg)
+	}
+	return nil
+}
+
+// zipConfigSet zips the files of a configset for uploading, without the <lib> directives of its solrconfig.xml
+func zipConfigSet(config fs.FS) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	err := fs.WalkDir(config, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(config, path)
+		if err != nil {
+			return err
+		}
+		if path == "solrconfig.xml" {
+			data = libDirective.ReplaceAll(data, nil)
+		}
+		w, err := zw.Create(path)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -3,9 +3,12 @@ package solr
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/url"
 	"reflect"
-	"strings"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
 	"github.com/RedisLabs/RediSearchBenchmark/query"
@@ -17,44 +20,72 @@ type Index struct {
 	si   *solr.SolrInterface
 	name string
 	md   *index.Metadata
+	// suggest is the core holding the suggestions, configured by suggest/solrconfig.xml
+	suggest *solr.SolrInterface
 }
 
-// NewIndex creates a new solr index for the given solr url and index name.
-// Metadata is ignored, we are using an automatic solr schema
+// suggestCoreSuffix is appended to the index name to name its suggestion core
+const suggestCoreSuffix = "_suggest"
+
+// suggest dictionaries of the suggestion core, matching prefixes exactly or up to one edit away
+const (
+	exactDictionary = "autocomplete"
+	fuzzyDictionary = "fuzzy"
+)
+
+// NewIndex creates a new solr index for the given solr url and index name, with its suggestions in the core named
+// after the index with a "_suggest" suffix. The metadata's fields are added to the schema when the index is created,
+// and its Options may be IndexOptions setting how documents are committed
 func NewIndex(url, name string, md *index.Metadata) (*Index, error) {
 	si, err := solr.NewSolrInterface(url, name)
 	if err != nil {
 		return nil, err
 	}
+	suggest, err := solr.NewSolrInterface(url, name+suggestCoreSuffix)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Index{
-		si:   si,
-		name: name,
-		md:   md,
+		si:      si,
+		name:    name,
+		md:      md,
+		suggest: suggest,
 	}, nil
 
 }
 
+// Refresh commits the indexed documents so they are searchable, with a soft commit if the index options ask for it
 func (i *Index) Refresh() error {
-
-        return nil
+	if indexOptions(i.md.Options).SoftCommit {
+		params := url.Values{"commit": []string{"true"}, "softCommit": []string{"true"}}
+		_, err := i.si.Update(map[string]interface{}{}, &params)
+		return err
+	}
+	_, err := i.si.Commit()
+	return err
 }
 
-// Index indexes multiple documents on the index, with optional IndexingOptions passed to options
+// Index indexes multiple documents on the index. They are committed within the CommitWithin of the index options,
+// or by the autoCommit settings of the core, and at the latest by Refresh
 func (i *Index) Index(documents []index.Document, options interface{}) error {
 
 	soldocs := make([]solr.Document, 0, len(documents))
 	for _, doc := range documents {
-		sd := solr.Document(doc.Properties)
+		sd := make(solr.Document, len(doc.Properties)+2)
+		for k, v := range doc.Properties {
+			sd[k] = v
+		}
 		sd["id"] = doc.Id
-		sd["score"] = doc.Score
-		// hack to support suggestions on the same index
-		sd["suggest"] = strings.ToLower(doc.Properties["title"].(string))
+		sd[docScoreField] = doc.Score
 
 		soldocs = append(soldocs, sd)
 	}
 
-	params := url.Values{"commit": []string{"true"}}
+	params := url.Values{}
+	if within := indexOptions(i.md.Options).CommitWithin; within > 0 {
+		params.Set("commitWithin", strconv.FormatInt(int64(within/time.Millisecond), 10))
+	}
 	_, err := i.si.Add(soldocs, len(soldocs), &params)
 	return err
 }
@@ -62,33 +93,49 @@ func (i *Index) Index(documents []index.Document, options interface{}) error {
 // Search searches the index for the given query, and returns documents,
 // the total number of results, or an error if something went wrong
 func (i *Index) Search(q query.Query) (docs []index.Document, total int, err error) {
+	res, err := i.SearchTimed(q)
+	return res.Docs, res.Total, err
+}
+
+// SearchTimed searches like Search, also returning the QTime solr reports for the search
+func (i *Index) SearchTimed(q query.Query) (index.SearchResponse, error) {
 	query := solr.NewQuery()
 	query.Q(q.Term)
 	query.AddParam("cache", "false")
-	//query.Start(int(q.Paging.Offset))
-	//query.Rows(int(q.Paging.Num))
+	// all the terms must match, in any of the text fields, like on the other engines
+	query.DefType("edismax")
+	query.QueryFields(queryFields(i.md))
+	query.AddParam("q.op", "AND")
+	query.FieldList("*,score")
+	query.Start(q.Paging.Offset)
+	query.Rows(q.Paging.Num)
 	s := i.si.Search(query)
 	r, err := s.Result(nil)
 	if err != nil {
-		return nil, 0, err
+		return index.SearchResponse{}, err
 	}
 
 	ret := make([]index.Document, 0, len(r.Results.Docs))
 	for _, d := range r.Results.Docs {
 
-		doc := index.NewDocument(d.Get("id").(string), 1.0)
+		score, _ := d.Get("score").(float64)
+		doc := index.NewDocument(d.Get("id").(string), float32(score))
 		for k, v := range d {
 			if reflect.TypeOf(v).Kind() == reflect.Slice {
 				v = v.([]interface{})[0]
 			}
-			if k != "id" {
+			if k != "id" && k != "score" && k != docScoreField && k != "_version_" {
 				doc.Set(k, v)
 			}
 		}
 		ret = append(ret, doc)
 	}
 
-	return ret, r.Results.NumFound, nil
+	return index.SearchResponse{
+		Docs:  ret,
+		Total: r.Results.NumFound,
+		Took:  time.Duration(r.QTime) * time.Millisecond,
+	}, nil
 }
 
 // Drop deletes the index
@@ -107,47 +154,264 @@ func (i *Index) Create() error {
 		return err
 	}
 
-	params := url.Values{}
-	params.Set("instanceDir", i.name)
-	params.Set("name", i.name)
-	_, err = ca.Action("CREATE", &params)
-	return err
+	for _, core := range []string{i.name, i.name + suggestCoreSuffix} {
+		params := url.Values{}
+		params.Set("instanceDir", core)
+		params.Set("name", core)
+		if _, err = ca.Action("CREATE", &params); err != nil {
+			return err
+		}
+	}
+	return i.createFields()
 }
 
-// AddTerms doesn't do anything and is here for interface compliance reasons.
-//
-// Not implemented since we do this automatically in the indexing itself
-func (i *Index) AddTerms(terms ...index.Suggestion) error {
-	// not implemented since we do this automatically in the indexing itself
+// createFields adds the fields of the metadata to the schema of the index with the Schema API, replacing the
+// fields that already exist, e.g. when the core was created with a previous schema
+func (i *Index) createFields() error {
+	schema, err := i.si.Schema()
+	if err != nil {
+		return err
+	}
+	res, err := schema.Get("fields", nil)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	if fields, ok := res.Response["fields"].([]interface{}); ok {
+		for _, f := range fields {
+			if def, ok := f.(map[string]interface{}); ok {
+				if name, ok := def["name"].(string); ok {
+					existing[name] = true
+				}
+			}
+		}
+	}
+
+	var add, replace []schemaField
+	for _, f := range schemaFields(i.md) {
+		if existing[f["name"].(string)] {
+			replace = append(replace, f)
+		} else {
+			add = append(add, f)
+		}
+	}
+	cmds := map[string]interface{}{}
+	if len(add) > 0 {
+		cmds["add-field"] = add
+	}
+	if len(replace) > 0 {
+		cmds["replace-field"] = replace
+	}
+	if res, err = schema.Post("", cmds); err != nil {
+		return err
+	}
+	// depending on the solr version, failed commands are reported under "errors" or "error"
+	for _, key := range []string{"errors", "error"} {
+		if errs, found := res.Response[key]; found {
+			return fmt.Errorf("could not update the schema of %s: %v", i.name, errs)
+		}
+	}
 	return nil
 }
 
-// SuggestResponse parses the suggest responses because the solr client doesn't include this feature
+// suggestionWeightScale scales suggestion scores to the long weights of the suggestion core, keeping six decimals of
+// fractional scores
+const suggestionWeightScale = 1e6
+
+// suggestionWeight converts a suggestion score to a weight of the suggestion core
+func suggestionWeight(score float64) int64 {
+	return int64(math.Round(score * suggestionWeightScale))
+}
+
+// suggestionScore converts a weight of the suggestion core back to a suggestion score
+func suggestionScore(weight float64) float64 {
+	return weight / suggestionWeightScale
+}
+
+// suggestionDocs converts suggestions to documents of the suggestion core, keyed by their term
+func suggestionDocs(terms []index.Suggestion) []solr.Document {
+	docs := make([]solr.Document, 0, len(terms))
+	for _, t := range terms {
+		d := solr.Document{"id": t.Term, "term": t.Term, "weight": suggestionWeight(t.Score)}
+		if t.Payload != "" {
+			d["payload"] = t.Payload
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+// AddTerms adds suggestions to the suggestion core, replacing the weight and payload of existing ones. The
+// suggest dictionaries are rebuilt on commit, so terms should be added in large batches
+func (i *Index) AddTerms(terms ...index.Suggestion) error {
+	params := url.Values{"commit": []string{"true"}}
+	_, err := i.suggest.Add(suggestionDocs(terms), len(terms), &params)
+	return err
+}
+
+// getDoc is a suggestion document returned by the real time get handler
+type getDoc struct {
+	Id      string `json:"id"`
+	Weight  int64  `json:"weight"`
+	Payload string `json:"payload"`
+}
+
+// getResponse parses the responses of the real time get handler: a single id is answered with the document or null
+// under "doc", several ids with a document list under "response"
+type getResponse struct {
+	Doc      *getDoc `json:"doc"`
+	Response struct {
+		NumFound int      `json:"numFound"`
+		Docs     []getDoc `json:"docs"`
+	} `json:"response"`
+}
+
+// docs returns the documents of the response, whatever its shape
+func (r getResponse) docs() []getDoc {
+	if r.Doc != nil {
+		return []getDoc{*r.Doc}
+	}
+	return r.Response.Docs
+}
+
+// getTerms reads the current suggestions of the given terms, including uncommitted ones. Terms are passed as
+// separate id params, since they may contain the commas separating the values of the ids param
+func (i *Index) getTerms(terms ...string) (map[string]index.Suggestion, error) {
+	params := url.Values{"id": terms}
+	b, err := i.suggest.Search(solr.NewQuery()).Resource("get", &params)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var res getResponse
+	if err := json.Unmarshal(*b, &res); err != nil {
+		return nil, err
+	}
+
+	docs := res.docs()
+	ret := make(map[string]index.Suggestion, len(docs))
+	for _, d := range docs {
+		ret[d.Id] = index.Suggestion{Term: d.Id, Score: suggestionScore(float64(d.Weight)), Payload: d.Payload}
+	}
+	return ret, nil
+}
+
+// IncrTerms adds suggestions to the suggestion core, adding their weight to that of existing ones.
+// The current weights are read first and the terms written back, so concurrent increments of a term may be lost
+func (i *Index) IncrTerms(terms ...index.Suggestion) error {
+	ids := make([]string, len(terms))
+	for n, t := range terms {
+		ids[n] = t.Term
+	}
+	current, err := i.getTerms(ids...)
+	if err != nil {
+		return err
+	}
+
+	incremented := make([]index.Suggestion, 0, len(terms))
+	for _, t := range terms {
+		if cur, found := current[t.Term]; found {
+			t.Score += cur.Score
+			if t.Payload == "" {
+				t.Payload = cur.Payload
+			}
+		}
+		incremented = append(incremented, t)
+	}
+	return i.AddTerms(incremented...)
+}
+
+// DeleteTerms deletes suggestions from the suggestion core, returning the number of terms that existed
+func (i *Index) DeleteTerms(terms ...string) (int, error) {
+	current, err := i.getTerms(terms...)
+	if err != nil || len(current) == 0 {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	params := url.Values{"commit": []string{"true"}}
+	if _, err := i.suggest.Update(map[string]interface{}{"delete": ids}, &params); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Len returns the number of suggestions in the suggestion core
+func (i *Index) Len() (int, error) {
+	query := solr.NewQuery()
+	query.Q("*:*")
+	query.Rows(0)
+	r, err := i.suggest.Search(query).Result(nil)
+	if err != nil {
+		return 0, err
+	}
+	return r.Results.NumFound, nil
+}
+
+// suggestion is a single suggestion of a suggest response
+type suggestion struct {
+	Term    string  `json:"term"`
+	Weight  float64 `json:"weight"`
+	Payload string  `json:"payload"`
+}
+
+// SuggestResponse parses the suggest responses because the solr client doesn't include this feature. Suggestions
+// are grouped by dictionary, then by the query they were found for
 type SuggestResponse struct {
 	ResponseHeader struct {
 		Status int `json:"status"`
 		QTime  int `json:"QTime"`
 	} `json:"responseHeader"`
-	Suggest struct {
-		Autocomplete map[string]struct {
-			NumFound    int `json:"numFound"`
-			Suggestions []struct {
-				Term    string  `json:"term"`
-				Weight  float64 `json:"weight"`
-				Payload string  `json:"payload"`
-			} `json:"suggestions"`
-		} `json:"autocomplete"`
+	Suggest map[string]map[string]struct {
+		NumFound    int          `json:"numFound"`
+		Suggestions []suggestion `json:"suggestions"`
 	} `json:"suggest"`
 }
 
-// Suggest gets completion suggestions from solr
+// Suggestions merges the suggestions of all the dictionaries of the response, keeping the highest weight of
+// suggestions found more than once, best first
+func (r *SuggestResponse) Suggestions(num int) []index.Suggestion {
+	merged := map[string]index.Suggestion{}
+	for _, queries := range r.Suggest {
+		for _, res := range queries {
+			for _, s := range res.Suggestions {
+				if cur, found := merged[s.Term]; !found || suggestionScore(s.Weight) > cur.Score {
+					merged[s.Term] = index.Suggestion{Term: s.Term, Score: suggestionScore(s.Weight), Payload: s.Payload}
+				}
+			}
+		}
+	}
+
+	ret := make([]index.Suggestion, 0, len(merged))
+	for _, s := range merged {
+		ret = append(ret, s)
+	}
+	sort.SliceStable(ret, func(x, y int) bool {
+		if ret[x].Score != ret[y].Score {
+			return ret[x].Score > ret[y].Score
+		}
+		return ret[x].Term < ret[y].Term
+	})
+	if len(ret) > num {
+		ret = ret[:num]
+	}
+	return ret
+}
+
+// Suggest gets completion suggestions from solr. Fuzzy suggestions also match prefixes one edit away
 func (i *Index) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion, error) {
-	s := i.si.Search(solr.NewQuery())
+	s := i.suggest.Search(solr.NewQuery())
 
 	parms := url.Values{}
 	parms.Set("suggest.q", prefix)
-	parms.Set("suggest.num", fmt.Sprintf("%d", num))
+	parms.Set("suggest.count", fmt.Sprintf("%d", num))
 	parms.Set("suggest", "true")
+	parms.Set("suggest.dictionary", exactDictionary)
+	if fuzzy {
+		parms.Set("suggest.dictionary", fuzzyDictionary)
+	}
 	b, err := s.Resource("suggest", &parms)
 	if err != nil || b == nil {
 		return nil, err
@@ -158,21 +422,15 @@ func (i *Index) Suggest(prefix string, num int, fuzzy bool) ([]index.Suggestion,
 	if err := json.Unmarshal(*b, &res); err != nil {
 		return nil, err
 	}
-
-	for _, s := range res.Suggest.Autocomplete {
-		ret := make([]index.Suggestion, 0, num)
-		for _, sugg := range s.Suggestions {
-			ret = append(ret, index.Suggestion{Term: sugg.Term, Score: sugg.Weight})
-		}
-
-		return ret, nil
-	}
-	return nil, nil
+	return res.Suggestions(num), nil
 
 }
 
-// Delete deletes all entries in the index
+// Delete deletes all the suggestions
 func (i *Index) Delete() error {
-	i.si.DeleteAll()
-	return nil
+	if _, err := i.suggest.DeleteAll(); err != nil {
+		return err
+	}
+	_, err := i.suggest.Commit()
+	return err
 }
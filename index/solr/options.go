@@ -0,0 +1,79 @@
+package solr
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// IndexOptions configure how documents are committed to a solr index. They are passed as the Options of the
+// index.Metadata given to NewIndex
+type IndexOptions struct {
+	// CommitWithin is the time within which solr commits indexed documents, 0 to leave it to the autoCommit settings
+	// of solrconfig.xml
+	CommitWithin time.Duration
+	// SoftCommit makes Refresh open a new searcher without flushing the index to disk
+	SoftCommit bool
+}
+
+// indexOptions returns the options in the metadata, or the zero options
+func indexOptions(opts interface{}) IndexOptions {
+	if o, ok := opts.(IndexOptions); ok {
+		return o
+	}
+	return IndexOptions{}
+}
+
+// docScoreField holds the score of documents, since the "score" field returned by searches is their relevance
+const docScoreField = "doc_score"
+
+// schemaField is a field definition of the Schema API
+type schemaField map[string]interface{}
+
+// schemaFields returns the field definitions of the metadata's fields, for the field types of the data driven
+// configset. Stemmed text fields are analyzed as english
+func schemaFields(md *index.Metadata) []schemaField {
+	fields := make([]schemaField, 0, len(md.Fields)+1)
+	for _, f := range md.Fields {
+		def := schemaField{"name": f.Name, "indexed": true, "stored": true}
+		switch f.Type {
+		case index.TextField:
+			def["type"] = "text_general"
+			if o, ok := f.Options.(index.TextFieldOptions); ok && o.Stemming {
+				def["type"] = "text_en"
+			}
+		case index.NumericField:
+			def["type"] = "tdouble"
+		case index.GeoField:
+			def["type"] = "location"
+		case index.ValueField:
+			def["type"] = "string"
+		case index.NoIndexField:
+			def["type"] = "string"
+			def["indexed"] = false
+		default:
+			continue
+		}
+		fields = append(fields, def)
+	}
+	return append(fields, schemaField{"name": docScoreField, "type": "tdouble", "indexed": false, "stored": true})
+}
+
+// queryFields returns the text fields searched by queries with their weights, in the edismax qf syntax
+func queryFields(md *index.Metadata) string {
+	qf := ""
+	for _, f := range md.Fields {
+		if f.Type != index.TextField {
+			continue
+		}
+		if qf != "" {
+			qf += " "
+		}
+		qf += f.Name
+		if o, ok := f.Options.(index.TextFieldOptions); ok && o.Weight > 0 && o.Weight != 1 {
+			qf += "^" + strconv.FormatFloat(float64(o.Weight), 'g', -1, 32)
+		}
+	}
+	return qf
+}
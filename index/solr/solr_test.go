@@ -1,7 +1,11 @@
 package solr
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"testing"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
@@ -29,6 +33,7 @@ func TestIndex(t *testing.T) {
 	//	assert.NoError(t, idx.Create())
 
 	assert.NoError(t, idx.Index(docs, nil))
+	assert.NoError(t, idx.Refresh())
 
 	q := query.NewQuery("testung", "hello world")
 	docs, total, err := idx.Search(*q)
@@ -37,5 +42,129 @@ func TestIndex(t *testing.T) {
 	assert.Len(t, docs, int(q.Paging.Num))
 	assert.Equal(t, docs[0].Id, "doc0")
 	assert.Equal(t, docs[0].Properties["title"], "hello world")
+	assert.True(t, docs[0].Score > 0)
 
+	// the last page holds the remaining documents
+	docs, _, err = idx.Search(*q.Limit(95, 10))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 5)
+
+}
+
+func TestAutocompleter(t *testing.T) {
+	ac, err := NewIndex("http://localhost:8983/solr", "testung", index.NewMetadata())
+	assert.NoError(t, err)
+
+	assert.NoError(t, ac.Delete())
+	assert.NoError(t, ac.AddTerms(
+		index.Suggestion{Term: "hello world", Score: 1},
+		index.Suggestion{Term: "hello", Score: 2},
+		index.Suggestion{Term: "jello world", Score: 3},
+	))
+
+	suggs, err := ac.Suggest("hel", 10, false)
+	assert.NoError(t, err)
+	assert.Len(t, suggs, 2)
+
+	suggs, err = ac.Suggest("hel", 10, true)
+	assert.NoError(t, err)
+	assert.Len(t, suggs, 3)
+
+	assert.NoError(t, ac.AddTerms(index.Suggestion{Term: "help", Score: 1, Payload: "doc1"}))
+	assert.NoError(t, ac.IncrTerms(index.Suggestion{Term: "help", Score: 9}))
+	suggs, err = ac.Suggest("help", 1, false)
+	assert.NoError(t, err)
+	if assert.Len(t, suggs, 1) {
+		assert.Equal(t, index.Suggestion{Term: "help", Score: 10, Payload: "doc1"}, suggs[0])
+	}
+
+	n, err := ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = ac.DeleteTerms("help", "nosuchterm")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = ac.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestSchemaFields(t *testing.T) {
+	md := index.NewMetadata().AddField(index.NewTextField("body", 1)).
+		AddField(index.NewTextField("title", 10)).
+		AddField(index.NewNumericField("year")).
+		AddField(index.NewNoIndexField("url"))
+
+	assert.Equal(t, []schemaField{
+		{"name": "body", "type": "text_en", "indexed": true, "stored": true},
+		{"name": "title", "type": "text_en", "indexed": true, "stored": true},
+		{"name": "year", "type": "tdouble", "indexed": true, "stored": true},
+		{"name": "url", "type": "string", "indexed": false, "stored": true},
+		{"name": docScoreField, "type": "tdouble", "indexed": false, "stored": true},
+	}, schemaFields(md))
+	assert.Equal(t, "body title^10", queryFields(md))
+}
+
+func TestConfigSet(t *testing.T) {
+	c, err := NewCloudIndex("http://localhost:8983/solr", "testung", index.NewMetadata(), 4, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.replicas)
+	colls, err := c.collections()
+	assert.NoError(t, err)
+
+	// the index configset has its base schema and no libraries, the suggestion configset its own configuration
+	for n, files := range [][]string{{"managed-schema", "solrconfig.xml"}, {"schema.xml", "solrconfig.xml"}} {
+		cs, err := zipConfigSet(colls[n].config)
+		assert.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(cs), int64(len(cs)))
+		assert.NoError(t, err)
+		names := []string{}
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			if f.Name == "solrconfig.xml" {
+				r, err := f.Open()
+				assert.NoError(t, err)
+				data, _ := io.ReadAll(r)
+				assert.NotContains(t, string(data), "<lib ")
+				assert.Contains(t, string(data), "</config>")
+			}
+		}
+		assert.Equal(t, files, names)
+	}
+	assert.Equal(t, []int{4, 1}, []int{colls[0].shards, colls[1].shards})
+}
+
+func TestGetResponse(t *testing.T) {
+	for reply, ids := range map[string][]string{
+		`{"doc": {"id": "hello", "weight": 2, "payload": "doc2"}}`: {"hello"},
+		`{"doc": null}`: {},
+		`{"response": {"numFound": 2, "start": 0, "docs": [{"id": "hello", "weight": 2}, {"id": "help", "weight": 1}]}}`: {"hello", "help"},
+	} {
+		var res getResponse
+		assert.NoError(t, json.Unmarshal([]byte(reply), &res))
+		got := []string{}
+		for _, d := range res.docs() {
+			got = append(got, d.Id)
+		}
+		assert.Equal(t, ids, got)
+	}
+}
+
+func TestSuggestResponse(t *testing.T) {
+	var res SuggestResponse
+	assert.NoError(t, json.Unmarshal([]byte(`{"responseHeader": {"status": 0, "QTime": 1}, "suggest": {
+		"autocomplete": {"hel": {"numFound": 2, "suggestions": [
+			{"term": "hello", "weight": 2500000, "payload": "doc2"}, {"term": "hello world", "weight": 1000000, "payload": ""}]}},
+		"fuzzy": {"hel": {"numFound": 2, "suggestions": [
+			{"term": "jello world", "weight": 3000000, "payload": ""}, {"term": "hello", "weight": 2500000, "payload": "doc2"}]}}}}`), &res))
+
+	assert.Equal(t, []index.Suggestion{
+		{Term: "jello world", Score: 3},
+		{Term: "hello", Score: 2.5, Payload: "doc2"},
+	}, res.Suggestions(2))
+	assert.Len(t, res.Suggestions(10), 3)
+
+	// fractional scores are kept by the weights of the suggestion core
+	docs := suggestionDocs([]index.Suggestion{{Term: "hello", Score: 0.25}})
+	assert.EqualValues(t, 250000, docs[0]["weight"])
 }
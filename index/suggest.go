@@ -6,11 +6,20 @@ import "sort"
 type Suggestion struct {
 	Term  string
 	Score float64
+	// Payload is an optional opaque value returned along with the suggestion, e.g. the id of a document
+	Payload string
 }
 
 // Autocompleter is an abstract interface for all auto-completers implemented on all engines
 type Autocompleter interface {
+	// AddTerms adds suggestions, replacing the score and payload of existing ones
 	AddTerms(terms ...Suggestion) error
+	// IncrTerms adds suggestions, incrementing the score of existing ones by the given score
+	IncrTerms(terms ...Suggestion) error
+	// DeleteTerms deletes suggestions by term, returning the number of suggestions deleted
+	DeleteTerms(terms ...string) (int, error)
+	// Len returns the number of suggestions
+	Len() (int, error)
 	Suggest(prefix string, num int, fuzzy bool) ([]Suggestion, error)
 	Delete() error
 }
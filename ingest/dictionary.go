@@ -0,0 +1,258 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// DictionaryWeighting decides how the candidate completions of a dictionary are weighted
+type DictionaryWeighting int
+
+const (
+	// WeightByScore weights titles by the score of their document, and n-grams by the total score of the
+	// documents containing them. If no document has a score, completions are weighted by frequency instead
+	WeightByScore DictionaryWeighting = iota
+
+	// WeightByFrequency weights titles and n-grams by the number of documents containing them
+	WeightByFrequency
+)
+
+// maxCandidates is the number of distinct n-grams we keep in memory before pruning the rarest ones
+const maxCandidates = 1000000
+
+// stopwords are not allowed at the start or end of n-gram completions
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "for": true,
+	"from": true, "has": true, "he": true, "in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
+	"or": true, "she": true, "that": true, "the": true, "to": true, "was": true, "were": true, "which": true,
+	"with": true,
+}
+
+// DictionaryOptions configure the extraction of candidate completions from documents
+type DictionaryOptions struct {
+	// TitleField is the document property whose whole value is a completion, e.g. "title". Empty to skip titles
+	TitleField string
+	// BodyField is the document property n-grams are extracted from, e.g. "body". Empty to skip n-grams
+	BodyField string
+	// NGrams is the maximal number of words of n-grams taken from the body, 0 to skip n-grams
+	NGrams int
+	// MinFreq is the minimal number of documents an n-gram must appear in to become a completion
+	MinFreq int
+	// MaxTerms caps the dictionary to the best weighted completions, 0 for no limit
+	MaxTerms  int
+	Weighting DictionaryWeighting
+}
+
+// DefaultDictionaryOptions builds a dictionary of document titles weighted by document score
+var DefaultDictionaryOptions = DictionaryOptions{
+	TitleField: "title",
+	BodyField:  "body",
+	MinFreq:    2,
+	Weighting:  WeightByScore,
+}
+
+// candidate is a completion found in the documents so far
+type candidate struct {
+	weight float64
+	freq   int
+	// payload is the id of the document a title came from, kept only while the title is unique
+	payload string
+}
+
+// DictionaryBuilder extracts weighted, de-duplicated completions from documents, to load into an autocompleter
+type DictionaryBuilder struct {
+	opts   DictionaryOptions
+	titles map[string]*candidate
+	ngrams map[string]*candidate
+	// pruned is the frequency under which n-grams were dropped to save memory
+	pruned int
+	// scored tells whether any document had a score
+	scored bool
+}
+
+// NewDictionaryBuilder creates a dictionary builder with the given options
+func NewDictionaryBuilder(opts DictionaryOptions) *DictionaryBuilder {
+	if opts.MinFreq < 1 {
+		opts.MinFreq = 1
+	}
+	return &DictionaryBuilder{
+		opts:   opts,
+		titles: map[string]*candidate{},
+		ngrams: map[string]*candidate{},
+	}
+}
+
+// docWeight is the weight a document adds to the completions found in it
+func (b *DictionaryBuilder) docWeight(doc index.Document) float64 {
+	if b.opts.Weighting == WeightByFrequency {
+		return 1
+	}
+	return float64(doc.Score)
+}
+
+// tokenize splits text into lowercase words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add extracts the candidate completions of a document
+func (b *DictionaryBuilder) Add(doc index.Document) {
+	w := b.docWeight(doc)
+	if doc.Score > 0 {
+		b.scored = true
+	}
+
+	if title, ok := doc.Properties[b.opts.TitleField].(string); ok && b.opts.TitleField != "" {
+		if term := strings.Join(tokenize(title), " "); term != "" {
+			c, found := b.titles[term]
+			if !found {
+				c = &candidate{payload: doc.Id}
+				b.titles[term] = c
+			} else if c.payload != doc.Id {
+				c.payload = ""
+			}
+			c.weight += w
+			c.freq++
+		}
+	}
+
+	body, ok := doc.Properties[b.opts.BodyField].(string)
+	if !ok || b.opts.BodyField == "" || b.opts.NGrams <= 0 {
+		return
+	}
+	// each n-gram counts once per document
+	words := tokenize(body)
+	seen := map[string]bool{}
+	for start := range words {
+		if stopwords[words[start]] {
+			continue
+		}
+		for n := 1; n <= b.opts.NGrams && start+n <= len(words); n++ {
+			if stopwords[words[start+n-1]] {
+				continue
+			}
+			term := strings.Join(words[start:start+n], " ")
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			c, found := b.ngrams[term]
+			if !found {
+				c = &candidate{}
+				b.ngrams[term] = c
+			}
+			c.weight += w
+			c.freq++
+		}
+	}
+	if len(b.ngrams) > maxCandidates {
+		b.prune()
+	}
+}
+
+// prune drops the rarest n-grams until the candidates fit in memory again. N-grams seen again after being dropped
+// start counting from scratch, so the frequencies of rare n-grams are underestimated
+func (b *DictionaryBuilder) prune() {
+	for len(b.ngrams) > maxCandidates/2 {
+		b.pruned++
+		for term, c := range b.ngrams {
+			if c.freq <= b.pruned {
+				delete(b.ngrams, term)
+			}
+		}
+	}
+}
+
+// weight returns the weight of a candidate. Weighting by score falls back to frequency when no document had a
+// score, e.g. when no scores were loaded, rather than weighting every completion 0
+func (b *DictionaryBuilder) weight(c *candidate) float64 {
+	if b.opts.Weighting == WeightByScore && !b.scored {
+		return float64(c.freq)
+	}
+	return c.weight
+}
+
+// Terms returns the completions found so far, best weighted first. A completion found both as a title and as an
+// n-gram keeps the higher weight
+func (b *DictionaryBuilder) Terms() []index.Suggestion {
+	merged := make(map[string]index.Suggestion, len(b.titles))
+	for term, c := range b.ngrams {
+		if w := b.weight(c); c.freq >= b.opts.MinFreq && w > 0 {
+			merged[term] = index.Suggestion{Term: term, Score: w}
+		}
+	}
+	for term, c := range b.titles {
+		if s, found := merged[term]; b.weight(c) > 0 && (!found || b.weight(c) >= s.Score) {
+			merged[term] = index.Suggestion{Term: term, Score: b.weight(c), Payload: c.payload}
+		}
+	}
+
+	ret := make([]index.Suggestion, 0, len(merged))
+	for _, s := range merged {
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(x, y int) bool {
+		if ret[x].Score != ret[y].Score {
+			return ret[x].Score > ret[y].Score
+		}
+		return ret[x].Term < ret[y].Term
+	})
+	if b.opts.MaxTerms > 0 && len(ret) > b.opts.MaxTerms {
+		ret = ret[:b.opts.MaxTerms]
+	}
+	return ret
+}
+
+// Load bulk loads the dictionary into an autocompleter, chunk terms at a time, returning the number of terms loaded
+func (b *DictionaryBuilder) Load(ac index.Autocompleter, chunk int) (int, error) {
+	terms := b.Terms()
+	for n := 0; n < len(terms); n += chunk {
+		end := n + chunk
+		if end > len(terms) {
+			end = len(terms)
+		}
+		if err := ac.AddTerms(terms[n:end]...); err != nil {
+			return n, err
+		}
+	}
+	return len(terms), nil
+}
+
+// ReadDictionary reads documents from a file without indexing them, and extracts their completions
+func ReadDictionary(fileName string, r DocumentReader, opts DictionaryOptions) (*DictionaryBuilder, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	ch, err := r.Read(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewDictionaryBuilder(opts)
+	for doc := range ch {
+		b.Add(doc)
+	}
+	return b, nil
+}
+
+// BuildDictionary reads documents from a file without indexing them, and loads the completions extracted from them
+// into an autocompleter
+func BuildDictionary(fileName string, r DocumentReader, ac index.Autocompleter, opts DictionaryOptions, chunk int) error {
+	b, err := ReadDictionary(fileName, r, opts)
+	if err != nil {
+		return err
+	}
+	n, err := b.Load(ac, chunk)
+	fmt.Println("Loaded", n, "suggestions")
+	return err
+}
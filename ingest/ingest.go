@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/RedisLabs/RediSearchBenchmark/index"
@@ -15,8 +15,9 @@ type DocumentReader interface {
 	Read(io.Reader) (<-chan index.Document, error)
 }
 
-// IngestDocuments ingests documents into an index using a DocumentReader
-func IngestDocuments(fileName string, r DocumentReader, idx index.Index, ac index.Autocompleter, opts interface{}, chunk int) error {
+// IngestDocuments ingests documents into an index using a DocumentReader. If dict is not nil, the candidate
+// completions of every document are added to it, to load into an autocompleter once ingestion is done
+func IngestDocuments(fileName string, r DocumentReader, idx index.Index, dict *DictionaryBuilder, opts interface{}, chunk int) error {
 
 	// open the file
 	fp, err := os.Open(fileName)
@@ -32,19 +33,19 @@ func IngestDocuments(fileName string, r DocumentReader, idx index.Index, ac inde
 	}
 
 	docs := make([]index.Document, chunk*2)
-	terms := make([]index.Suggestion, chunk*2)
 
-	//freqs := map[string]int{}
 	st := time.Now()
 
-	nterms := 0
 	i := 0
 	n := 0
 	dt := 0
 	totalDt := 0
 	doch := make(chan index.Document, 100)
+	var wg sync.WaitGroup
 	for w := 0; w < 400; w++ {
+		wg.Add(1)
 		go func(doch chan index.Document) {
+			defer wg.Done()
 			for doc := range doch {
 				if doc.Id != "" {
 					//fmt.Println(doc)
@@ -59,33 +60,8 @@ func IngestDocuments(fileName string, r DocumentReader, idx index.Index, ac inde
 
 		docs[i%chunk] = doc
 
-		if doc.Score > 0 && ac != nil {
-
-			//			words := strings.Fields(strings.ToLower(doc.Properties["body"].(string)))
-			//			for _, w := range words {
-			//				for i := 2; i < len(w) && i < 5; i++ {
-			//					freqs[w[:i]] += 1
-			//				}
-			//			}
-
-			terms[nterms] = index.Suggestion{
-				strings.ToLower(doc.Properties["title"].(string)),
-				float64(doc.Score),
-			}
-			nterms++
-
-			if nterms == chunk {
-
-				//				for k, v := range freqs {
-				//					fmt.Printf("%d %s\n", v, k)
-				//				}
-				//				os.Exit(0)
-				/*if err := ac.AddTerms(terms...); err != nil {
-					return err
-				}*/
-				nterms = 0
-			}
-
+		if dict != nil {
+			dict.Add(doc)
 		}
 		if doc.Score == 0 {
 			doc.Score = 0.0000001
@@ -120,11 +96,13 @@ func IngestDocuments(fileName string, r DocumentReader, idx index.Index, ac inde
 		}
 	}
 
+	// wait for the queued documents, then index the last partial chunk and make everything searchable
+	close(doch)
+	wg.Wait()
 	if i%chunk != 0 {
-		go idx.Index(docs[:i%chunk], opts)
-                // Refresh here
-                _ = idx.Refresh()
-		return nil
+		if err := idx.Index(docs[:i%chunk], opts); err != nil {
+			return err
+		}
 	}
-	return nil
+	return idx.Refresh()
 }
@@ -0,0 +1,56 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictionaryBuilder(t *testing.T) {
+	docs := []index.Document{
+		index.NewDocument("doc1", 3).Set("title", "Hello World").Set("body", "the quick brown fox"),
+		index.NewDocument("doc2", 2).Set("title", "hello, world").Set("body", "a quick brown dog and the quick brown fox"),
+		index.NewDocument("doc3", 1).Set("title", "Foo").Set("body", "lazy dog"),
+		index.NewDocument("doc4", 0).Set("title", "Unscored"),
+	}
+
+	// titles only, weighted by score and de-duplicated, with the document id of unique titles
+	b := NewDictionaryBuilder(DefaultDictionaryOptions)
+	for _, d := range docs {
+		b.Add(d)
+	}
+	assert.Equal(t, []index.Suggestion{
+		{Term: "hello world", Score: 5},
+		{Term: "foo", Score: 1, Payload: "doc3"},
+	}, b.Terms())
+
+	// n-grams appearing in at least two documents, weighted by frequency, never starting or ending with stopwords
+	opts := DefaultDictionaryOptions
+	opts.TitleField = ""
+	opts.NGrams = 2
+	opts.Weighting = WeightByFrequency
+	opts.MaxTerms = 4
+	b = NewDictionaryBuilder(opts)
+	for _, d := range docs {
+		b.Add(d)
+	}
+	assert.Equal(t, []index.Suggestion{
+		{Term: "brown", Score: 2},
+		{Term: "brown fox", Score: 2},
+		{Term: "dog", Score: 2},
+		{Term: "fox", Score: 2},
+	}, b.Terms())
+
+	// without any document score, weighting by score falls back to frequency rather than dropping every completion
+	b = NewDictionaryBuilder(DefaultDictionaryOptions)
+	for _, d := range docs {
+		d.Score = 0
+		b.Add(d)
+	}
+	assert.Equal(t, []index.Suggestion{
+		{Term: "hello world", Score: 2},
+		{Term: "foo", Score: 1, Payload: "doc3"},
+		{Term: "unscored", Score: 1, Payload: "doc4"},
+	}, b.Terms())
+}
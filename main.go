@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"bufio"
+	"math/rand"
         "os"
 	"strings"
 	"time"
@@ -20,45 +21,167 @@ import (
 // IndexName is the name of our index on all engines
 const IndexName = "wik"
 
+// spellDict is the name of the custom dictionary loaded for the spellcheck benchmark
+const spellDict = "spelldict"
+
+// indexMetadata is the schema of the wikipedia abstracts. Their scores are indexed as the score of each document
+// rather than as a field
 var indexMetadata = index.NewMetadata().
-	AddField(index.NewTextField("body", 1))
-	//AddField(index.NewTextField("title", 10)).
-	//AddField(index.NewNumericField("score"))
+	AddField(index.NewTextField("body", 1)).
+	AddField(index.NewTextField("title", 10)).
+	AddField(index.NewNoIndexField("url"))
 
 // selectIndex selects and configures the index we are now running based on the engine name, hosts and number of shards
-func selectIndex(engine string, hosts []string, partitions int, cmdPrefix string) (index.Index, index.Autocompleter, interface{}) {
+func selectIndex(engine string, hosts []string, partitions, replicas int, cmdPrefix string, mode redisearch.IndexingMode,
+	conn *redisearch.ConnectionOptions, cluster bool, distOpts []redisearch.DistributedOption, bulk elastic.BulkOptions, solrOpts solr.IndexOptions) (index.Index, index.Autocompleter, interface{}) {
 
 	switch engine {
 	case "redis":
+		indexMetadata.Options = redisearch.IndexingOptions{Mode: mode}
+		if cluster {
+			idx, err := redisearch.NewClusterIndex(IndexName, hosts, partitions, indexMetadata, conn, distOpts...)
+			if err != nil {
+				panic(err)
+			}
+			return idx, idx, query.QueryVerbatim
+		}
 
 		//return redisearch.NewIndex(hosts[0], "wik{0}", indexMetadata)
-		idx := redisearch.NewDistributedIndex(IndexName, hosts, partitions, indexMetadata)
+		idx, err := redisearch.NewDistributedIndex(IndexName, hosts, partitions, indexMetadata, conn, distOpts...)
+		if err != nil {
+			panic(err)
+		}
 		return idx, idx, query.QueryVerbatim
 
 	case "redismod":
-		indexMetadata.Options = redisearch.IndexingOptions{Prefix: cmdPrefix}
+		indexMetadata.Options = redisearch.IndexingOptions{Prefix: cmdPrefix, Mode: mode}
 		//return redisearch.NewIndex(hosts[0], "wik{0}", indexMetadata)
-		idx := redisearch.NewIndex(hosts[0], "wiki", indexMetadata)
-		ac := redisearch.NewAutocompleter(hosts[0], "ac")
+		idx := redisearch.NewIndex(hosts[0], "wiki", indexMetadata, conn)
+		ac := redisearch.NewAutocompleter(hosts[0], "ac", conn)
 		return idx, ac, query.QueryVerbatim
 
 	case "elastic":
-		idx, err := elastic.NewIndex(hosts[0], IndexName, "doc", indexMetadata)
+		opts := elastic.DefaultIndexOptions
+		opts.Shards = partitions
+		opts.Bulk = bulk
+		indexMetadata.Options = opts
+		idx, err := elastic.NewIndex(hosts[0], IndexName, indexMetadata)
 		if err != nil {
 			panic(err)
 		}
 		fmt.Println("after get newindex====");
                 return idx, idx, 0
 	case "solr":
+		indexMetadata.Options = solrOpts
 		idx, err := solr.NewIndex(hosts[0], IndexName, indexMetadata)
 		if err != nil {
 			panic(err)
 		}
 		return idx, idx, 0
+	case "solrcloud":
+		indexMetadata.Options = solrOpts
+		idx, err := solr.NewCloudIndex(hosts[0], IndexName, indexMetadata, partitions, replicas)
+		if err != nil {
+			panic(err)
+		}
+		return idx, idx, 0
 
 	}
 	panic("could not find index type " + engine)
 }
+
+// selectPartitioner creates the partitioner named by the -partitioner flag
+func selectPartitioner(name string, partitions int) redisearch.Partitioner {
+	switch name {
+	case "modulo":
+		return redisearch.NewModuloPartitioner(partitions)
+	case "jump":
+		return redisearch.NewJumpPartitioner(partitions)
+	case "rendezvous":
+		return redisearch.NewRendezvousPartitioner(partitions)
+	}
+	panic("invalid partitioner " + name)
+}
+
+// selectReplicaOptions converts the replication flags to the replica options of a distributed index
+func selectReplicaOptions(replicas int, mode, balancer string, failover time.Duration) redisearch.ReplicaOptions {
+	opts := redisearch.ReplicaOptions{Replicas: replicas, FailoverPeriod: failover}
+	switch mode {
+	case "all":
+		opts.Mode = redisearch.WriteAllReplicas
+	case "primary":
+		opts.Mode = redisearch.WritePrimary
+	default:
+		panic("invalid replication mode " + mode)
+	}
+	switch balancer {
+	case "roundrobin":
+		opts.Balancer = redisearch.RoundRobin
+	case "leastoutstanding":
+		opts.Balancer = redisearch.LeastOutstanding
+	case "ewma":
+		opts.Balancer = redisearch.LatencyEWMA
+	default:
+		panic("invalid replica balancer " + balancer)
+	}
+	return opts
+}
+
+// selectDictionaryOptions converts the suggestion dictionary flags to dictionary builder options
+func selectDictionaryOptions(ngrams, minFreq, maxTerms int, weighting string) ingest.DictionaryOptions {
+	opts := ingest.DefaultDictionaryOptions
+	opts.NGrams = ngrams
+	opts.MinFreq = minFreq
+	opts.MaxTerms = maxTerms
+	switch weighting {
+	case "score":
+		opts.Weighting = ingest.WeightByScore
+	case "frequency":
+		opts.Weighting = ingest.WeightByFrequency
+	default:
+		panic("invalid dictionary weighting " + weighting)
+	}
+	return opts
+}
+
+// loadSuggestQueries loads the queries typed in the suggest benchmark from a query log, or from the suggestion
+// dictionary of the documents of the input file, scored by the scores file if there is one
+func loadSuggestQueries(queryLog, fileName, scoreFile string, dictOpts ingest.DictionaryOptions) []index.Suggestion {
+	if queryLog != "" {
+		queries, err := synth.LoadQueries(queryLog)
+		if err != nil {
+			panic(err)
+		}
+		return queries
+	}
+	if fileName == "" {
+		panic("the suggest benchmark needs a query log (-suggestqueries) or documents to build a dictionary from (-file)")
+	}
+	wr := ingest.NewWikipediaAbstractsReader()
+	if scoreFile != "" {
+		if err := wr.LoadScores(scoreFile); err != nil {
+			panic(err)
+		}
+	}
+	dict, err := ingest.ReadDictionary(fileName, wr, dictOpts)
+	if err != nil {
+		panic(err)
+	}
+	return dict.Terms()
+}
+
+// parseIndexingMode converts the -redismode flag to a redisearch indexing mode
+func parseIndexingMode(mode string) redisearch.IndexingMode {
+	switch mode {
+	case "legacy":
+		return redisearch.LegacyMode
+	case "hash":
+		return redisearch.HashMode
+	case "json":
+		return redisearch.JSONMode
+	}
+	panic("invalid redis indexing mode " + mode)
+}
 func loadQueryPool(file_path string) ([]string){
         fmt.Println("Query Pool Path: ", file_path)
         // load document
@@ -81,6 +204,26 @@ func loadQueryPool(file_path string) ([]string){
         return querypool
 }
 
+// loadAggregations loads a pool of aggregations from a file, one aggregation per line in the form
+// accepted by redisearch.ParseAggregation
+func loadAggregations(path string) []*redisearch.Aggregation {
+	aggs := []*redisearch.Aggregation{}
+	for _, line := range loadQueryPool(path) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		a, err := redisearch.ParseAggregation(line)
+		if err != nil {
+			panic(err)
+		}
+		aggs = append(aggs, a)
+	}
+	if len(aggs) == 0 {
+		panic("no aggregations in " + path)
+	}
+	return aggs
+}
+
 func main() {
 
 	hosts := flag.String("hosts", "localhost:6379", "comma separated list of host:port to redis nodes")
@@ -88,9 +231,9 @@ func main() {
 	fileName := flag.String("file", "", "Input file to ingest data from (wikipedia abstracts)")
 	scoreFile := flag.String("scores", "", "read scores of documents CSV for indexing")
 	engine := flag.String("engine", "redis", "The search backend to run")
-	benchmark := flag.String("benchmark", "", "[search|suggest] - if set, we run the given benchmark")
+	benchmark := flag.String("benchmark", "", "[search|suggest|aggregate|spellcheck] - if set, we run the given benchmark")
 	random := flag.Int("random", 0, "Generate random documents with terms like term0..term{N}")
-	fuzzy := flag.Bool("fuzzy", false, "For redis only - benchmark fuzzy auto suggest")
+	fuzzy := flag.Bool("fuzzy", false, "For redis, elastic and solr - benchmark fuzzy auto suggest")
 	seconds := flag.Int("duration", 100, "number of seconds to run the benchmark")
 	conc := flag.Int("c", 4, "benchmark concurrency")
 	qs := flag.String("queries", "hello world", "comma separated list of queries to benchmark")
@@ -98,12 +241,70 @@ func main() {
 	duration := time.Second * time.Duration(*seconds)
 	cmdPrefix := flag.String("prefix", "FT", "Command prefix for FT module")
         querypath := flag.String("querypath", "", "Query pool for benchmark")
+	aggPath := flag.String("aggregations", "", "For the aggregate benchmark - file of aggregations, one per line")
+	distance := flag.Int("distance", 1, "For the spellcheck benchmark and fuzzy suggestions on elastic - maximal Levenshtein distance of suggestions")
+	dictFile := flag.String("dict", "", "For the spellcheck benchmark - file of terms to load to a custom dictionary included in suggestions")
+	synFile := flag.String("synonyms", "", "For redis only - file of comma separated synonym groups to load when ingesting")
+	connectTimeout := flag.Duration("timeout", 0, "For redis only - connect timeout, 0 for none")
+	readTimeout := flag.Duration("readtimeout", 0, "For redis only - read timeout, 0 for none")
+	writeTimeout := flag.Duration("writetimeout", 0, "For redis only - write timeout, 0 for none")
+	user := flag.String("user", "", "For redis only - ACL user to authenticate as")
+	password := flag.String("password", "", "For redis only - password to authenticate with")
+	useTLS := flag.Bool("tls", false, "For redis only - connect over TLS")
+	caCert := flag.String("cacert", "", "For redis only - CA certificate file to verify the server with")
+	cert := flag.String("cert", "", "For redis only - client certificate file for TLS")
+	key := flag.String("key", "", "For redis only - client key file for TLS")
+	db := flag.Int("db", 0, "For redis only - database number to select")
+	maxActive := flag.Int("maxactive", 0, "For redis only - maximal connections per host, 0 for unlimited")
+	maxIdle := flag.Int("maxidle", 500, "For redis only - maximal idle connections per host")
+	idleTimeout := flag.Duration("idletimeout", 0, "For redis only - close connections idle for longer than this, 0 to keep them")
+	healthCheck := flag.Duration("healthcheck", 0, "For redis only - ping connections idle for longer than this before using them, 0 to disable")
+	partitioner := flag.String("partitioner", "modulo", "For redis only - [modulo|jump|rendezvous] how documents are assigned to shards")
+	shardTimeout := flag.Duration("shardtimeout", 0, "For redis only - deadline for all shards to answer a search, 0 to wait for all")
+	bestEffort := flag.Bool("besteffort", false, "For redis only - return partial results when shards fail or time out, instead of failing")
+	hedge := flag.Float64("hedge", 0, "For redis only - if set, resend shard requests slower than this percentile of recent shard latencies, e.g. 0.95")
+	hedgeMinDelay := flag.Duration("hedgemindelay", time.Millisecond, "For redis only - minimal delay before hedging a shard request")
+	retries := flag.Int("retries", 0, "For redis only - number of retries of shard requests failing with connection errors")
+	retryBackoff := flag.Duration("retrybackoff", 10*time.Millisecond, "For redis only - delay before the first retry, doubled for each further retry")
+	replicas := flag.Int("replicas", 1, "For redis and solrcloud - number of hosts backing each shard, replica r of shard n is on host n*replicas+r on redis")
+	replication := flag.String("replication", "all", "For redis only - [all|primary] write to all replicas, or to the first one only when the others are redis replicas of it")
+	balancer := flag.String("balancer", "roundrobin", "For redis only - [roundrobin|leastoutstanding|ewma] how reads are balanced over replicas")
+	failover := flag.Duration("failover", time.Second, "For redis only - how long a replica failing with connection errors is skipped")
+	globalScoring := flag.Bool("globalscoring", false, "For redis only - rescore sharded search results with index-wide term statistics, at the cost of two extra round trips per shard. Only the top 2x results of each shard are rescored")
+	serverTimeFlag := flag.Bool("servertime", false, "For search benchmarks - compare the search time reported by the engine with the round trip time. Searches are profiled on redis, which slows them down")
+	shardStatsFlag := flag.Bool("shardstats", false, "For redis only - print a per shard latency breakdown after search benchmarks, highlighting stragglers")
+	suggestRouting := flag.Int("suggestrouting", 0, "For redis only - if set, place suggestions by their first N characters and answer longer prefixes from a single shard")
+	reshard := flag.Int("reshard", 0, "For redis only - if set, move the existing index from -shards to this number of shards")
+	cluster := flag.Bool("cluster", false, "For redis only - hosts are seed nodes of a Redis Cluster, partitions are placed by slot ownership")
+	suggestDict := flag.String("suggestdict", "", "[ingest|only] build a suggestion dictionary from -file while ingesting it, or only build the dictionary without indexing documents")
+	ngrams := flag.Int("ngrams", 0, "For the suggestion dictionary - maximal number of words of completions taken from document bodies, 0 for titles only")
+	minFreq := flag.Int("minfreq", 2, "For the suggestion dictionary - minimal number of documents a completion from bodies must appear in")
+	maxTerms := flag.Int("maxterms", 0, "For the suggestion dictionary - keep only the best weighted completions, 0 for all")
+	weighting := flag.String("weighting", "score", "For the suggestion dictionary - [score|frequency] weight completions by document score (from -scores, by frequency without scores) or by number of documents")
+	suggestQueries := flag.String("suggestqueries", "", "For the suggest benchmark - query log to type, one query per line optionally followed by a tab and its count. If not set, queries are taken from the suggestion dictionary of -file")
+	minPrefix := flag.Int("minprefix", 2, "For the suggest benchmark - number of characters typed before the first suggestion request")
+	maxPrefix := flag.Int("maxprefix", 0, "For the suggest benchmark - number of characters after which users stop typing, 0 to type whole queries")
+	stopProb := flag.Float64("stopprob", 0.2, "For the suggest benchmark - probability of stopping typing after each suggestion request")
+	zipf := flag.Float64("zipf", 1.1, "For the suggest benchmark - exponent of the Zipfian popularity of queries, greater than 1")
+	seed := flag.Int64("seed", 1, "For the suggest benchmark - random seed, the same seed types the same prefixes")
+	trackTotalHits := flag.Int("tracktotalhits", 0, "For elastic only - number of hits searches count exactly, 0 for the elastic default of 10000, -1 for all")
+	bulkActions := flag.Int("bulkactions", elastic.DefaultBulkOptions.Actions, "For elastic only - number of documents per bulk request")
+	bulkBytes := flag.Int("bulkbytes", elastic.DefaultBulkOptions.Bytes, "For elastic only - maximal size of a bulk request in bytes")
+	bulkFlush := flag.Duration("bulkflush", elastic.DefaultBulkOptions.FlushInterval, "For elastic only - send a bulk request this long after its first document, even if not full")
+	bulkWorkers := flag.Int("bulkworkers", elastic.DefaultBulkOptions.Workers, "For elastic only - number of bulk requests in flight, indexing blocks while they are all busy")
+	commitWithin := flag.Duration("commitwithin", 0, "For solr only - commit indexed documents within this time, 0 to leave it to the autoCommit settings of the core")
+	softCommit := flag.Bool("softcommit", false, "For solr only - make documents searchable after ingestion with a soft commit, without flushing the index to disk")
+	redisMode := flag.String("redismode", "legacy", "For redis only - [legacy|hash|json] index with FT.ADD, or from hashes/JSON keys (RediSearch 2.0+)")
 
 	flag.Parse()
 	servers := strings.Split(*hosts, ",")
 	if len(servers) == 0 {
 		panic("No servers given")
 	}
+	// shard stats and server times are recorded by different search calls
+	if *shardStatsFlag && *serverTimeFlag {
+		panic("-shardstats and -servertime can't be used together")
+	}
 
         var queries []string
         if *querypath == "" {
@@ -114,7 +315,64 @@ func main() {
         }
 
 	// select index to run
-	idx, ac, opts := selectIndex(*engine, servers, *partitions, *cmdPrefix)
+	conn := &redisearch.ConnectionOptions{
+		ConnectTimeout: *connectTimeout,
+		ReadTimeout:    *readTimeout,
+		WriteTimeout:   *writeTimeout,
+		Username:       *user,
+		Password:       *password,
+		TLS:            *useTLS,
+		CACertFile:     *caCert,
+		CertFile:       *cert,
+		KeyFile:        *key,
+		DB:             *db,
+		MaxActive:      *maxActive,
+		MaxIdle:        *maxIdle,
+		IdleTimeout:    *idleTimeout,
+		HealthCheck:    *healthCheck,
+	}
+	distOpts := []redisearch.DistributedOption{
+		redisearch.WithPartitioner(selectPartitioner(*partitioner, *partitions)),
+		redisearch.WithTimeout(*shardTimeout),
+		redisearch.WithHedging(*hedge, *hedgeMinDelay),
+		redisearch.WithRetries(*retries, *retryBackoff),
+		redisearch.WithReplicas(selectReplicaOptions(*replicas, *replication, *balancer, *failover)),
+	}
+	if *suggestRouting > 0 {
+		distOpts = append(distOpts, redisearch.WithPrefixRouting(*suggestRouting))
+	}
+	if *globalScoring {
+		distOpts = append(distOpts, redisearch.WithGlobalScoring())
+	}
+	if *bestEffort {
+		distOpts = append(distOpts, redisearch.WithShardFailurePolicy(redisearch.BestEffort))
+	}
+	bulkOpts := elastic.DefaultBulkOptions
+	bulkOpts.Actions, bulkOpts.Bytes, bulkOpts.FlushInterval, bulkOpts.Workers = *bulkActions, *bulkBytes, *bulkFlush, *bulkWorkers
+	idx, ac, opts := selectIndex(*engine, servers, *partitions, *replicas, *cmdPrefix, parseIndexingMode(*redisMode), conn, *cluster, distOpts, bulkOpts,
+		solr.IndexOptions{CommitWithin: *commitWithin, SoftCommit: *softCommit})
+	if ei, ok := idx.(*elastic.Index); ok {
+		ei.SetSuggestDistance(*distance)
+		ei.SetTrackTotalHits(*trackTotalHits)
+	}
+
+	// Reshard an existing index online
+	if *reshard > 0 {
+		di, ok := idx.(*redisearch.DistributedIndex)
+		if !ok {
+			panic("engine " + *engine + " does not support resharding")
+		}
+		st := time.Now()
+		err := di.Reshard(*reshard, selectPartitioner(*partitioner, *reshard), func(p redisearch.ReshardProgress) {
+			fmt.Printf("partition %d/%d: scanned %d moved %d documents (%.0f docs/s)\n", p.Partition+1, p.NumPartitions,
+				p.Scanned, p.Moved, float64(p.Scanned)/time.Since(st).Seconds())
+		})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("Resharded to", *reshard, "shards in", time.Since(st))
+		os.Exit(0)
+	}
 
 	// Search benchmark
 	if *benchmark == "search" {
@@ -125,13 +383,80 @@ func main() {
                 }
                 name := fmt.Sprintf("search: %s %d", name_str, len(queries))
                 //Benchmark(*conc, duration, *engine, name, *outfile, SearchBenchmark(queries, querytype, idx, opts))
+		if *shardStatsFlag {
+			shardStats = NewShardStats()
+		}
+		if *serverTimeFlag {
+			serverTimes = NewServerTimes()
+		}
                 Benchmark(*conc, duration, *engine, name, *outfile, SearchBenchmark(queries, idx, opts))
+		if shardStats != nil {
+			shardStats.Print(os.Stdout)
+		}
+		if serverTimes != nil {
+			serverTimes.Print(os.Stdout)
+		}
+		if di, ok := idx.(*redisearch.DistributedIndex); ok {
+			st := di.HedgeStats()
+			fmt.Printf("Hedges sent: %d, won: %d, retries: %d\n", st.HedgesSent, st.HedgesWon, st.Retries)
+			es := di.ExecutorStats()
+			fmt.Printf("Shard requests: %d, queue wait avg: %v, max: %v\n", es.Tasks, es.AvgWait(), es.MaxWait)
+		}
+		os.Exit(0)
+	}
+
+	// Aggregation benchmark, on engines supporting FT.AGGREGATE
+	if *benchmark == "aggregate" {
+		ag, ok := idx.(Aggregator)
+		if !ok {
+			panic("engine " + *engine + " does not support aggregations")
+		}
+		aggs := loadAggregations(*aggPath)
+		name := fmt.Sprintf("aggregate: %s %d", *aggPath, len(aggs))
+		Benchmark(*conc, duration, *engine, name, *outfile, AggregateBenchmark(aggs, ag))
+		os.Exit(0)
+	}
+
+	// Spellcheck benchmark, on misspelled variants of the queries
+	if *benchmark == "spellcheck" {
+		sc, ok := idx.(SpellChecker)
+		if !ok {
+			panic("engine " + *engine + " does not support spellcheck")
+		}
+		opts := redisearch.SpellCheckOptions{Distance: *distance}
+		if *dictFile != "" {
+			if err := sc.LoadDictionary(spellDict, *dictFile); err != nil {
+				panic(err)
+			}
+			opts.Include = []string{spellDict}
+		}
+		rng := rand.New(rand.NewSource(int64(len(queries))))
+		misspelled := make([]string, 0, len(queries))
+		for _, q := range queries {
+			misspelled = append(misspelled, misspell(q, rng))
+		}
+		name := fmt.Sprintf("spellcheck: %s %d", strings.Replace(*qs, " ", "_", -1), len(queries))
+		if *querypath != "" {
+			name = fmt.Sprintf("spellcheck: %s %d", *querypath, len(queries))
+		}
+		Benchmark(*conc, duration, *engine, name, *outfile, SpellCheckBenchmark(misspelled, sc, opts))
 		os.Exit(0)
 	}
 
 	// Auto-suggest benchmark
 	if *benchmark == "suggest" {
-		Benchmark(*conc, duration, *engine, "suggest", *outfile, AutocompleteBenchmark(ac, *fuzzy))
+		routing := "fanout"
+		if *suggestRouting > 0 {
+			routing = fmt.Sprintf("prefix%d", *suggestRouting)
+		}
+		queries := loadSuggestQueries(*suggestQueries, *fileName, *scoreFile, selectDictionaryOptions(*ngrams, *minFreq, *maxTerms, *weighting))
+		model := synth.TypingModel{MinPrefix: *minPrefix, MaxPrefix: *maxPrefix, StopProb: *stopProb, Zipf: *zipf}
+		gen, err := synth.NewPrefixGenerator(queries, model, *seed)
+		if err != nil {
+			panic(err)
+		}
+		name := fmt.Sprintf("suggest: %s %d", routing, gen.Len())
+		Benchmark(*conc, duration, *engine, name, *outfile, AutocompleteBenchmark(ac, gen, *fuzzy))
 		os.Exit(0)
 	}
 
@@ -163,6 +488,24 @@ func main() {
 		}
 
 	}
+	// build the suggestion dictionary alone, without indexing documents
+	if *fileName != "" && *benchmark == "" && *suggestDict == "only" {
+		if ac == nil {
+			panic("engine " + *engine + " does not support suggestions")
+		}
+		ac.Delete()
+		wr := ingest.NewWikipediaAbstractsReader()
+		if *scoreFile != "" {
+			if err := wr.LoadScores(*scoreFile); err != nil {
+				panic(err)
+			}
+		}
+		if err := ingest.BuildDictionary(*fileName, wr, ac, selectDictionaryOptions(*ngrams, *minFreq, *maxTerms, *weighting), 1000); err != nil {
+			panic(err)
+		}
+		os.Exit(0)
+	}
+
 	// ingest documents into the selected engine
 	if *fileName != "" && *benchmark == "" {
 		fmt.Println("Prepare to index...")
@@ -172,6 +515,15 @@ func main() {
 
 		idx.Drop()
 		idx.Create()
+		if *synFile != "" {
+			syn, ok := idx.(SynonymLoader)
+			if !ok {
+				panic("engine " + *engine + " does not support synonyms")
+			}
+			if err := syn.LoadSynonyms(*synFile); err != nil {
+				panic(err)
+			}
+		}
 		wr := ingest.NewWikipediaAbstractsReader()
 
 		if *scoreFile != "" {
@@ -179,11 +531,30 @@ func main() {
 				panic(err)
 			}
 		}
+		var dict *ingest.DictionaryBuilder
+		if *suggestDict == "ingest" && ac != nil {
+			dict = ingest.NewDictionaryBuilder(selectDictionaryOptions(*ngrams, *minFreq, *maxTerms, *weighting))
+		}
                 fmt.Println("===== Prepare to ingest")
-		if err := ingest.IngestDocuments(*fileName, wr, idx, ac, redisearch.IndexingOptions{NoSave: false,
-			NoOffsetVectors: true}, 1000); err != nil {
+		err := ingest.IngestDocuments(*fileName, wr, idx, dict, redisearch.IndexingOptions{NoSave: false,
+			NoOffsetVectors: true}, 1000)
+		if ei, ok := idx.(*elastic.Index); ok {
+			st := ei.BulkStats()
+			fmt.Println("Sent", st.Bulks, "bulk requests:", st.Indexed, "documents indexed,", st.Failed, "failed")
+			for _, e := range st.Errors {
+				fmt.Println(e)
+			}
+		}
+		if err != nil {
 			panic(err)
 		}
+		if dict != nil {
+			n, err := dict.Load(ac, 1000)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println("Loaded", n, "suggestions")
+		}
 
 		os.Exit(0)
 	}
@@ -1,1163 +0,0 @@
-package main
-
-var prefixes = []string{"th",
-	"co",
-	"an",
-	"re",
-	"st",
-	"ma",
-	"in",
-	"pr",
-	"fo",
-	"wa",
-	"de",
-	"cou",
-	"sta",
-	"ar",
-	"ca",
-	"se",
-	"po",
-	"un",
-	"fr",
-	"wi",
-	"wh",
-	"mo",
-	"com",
-	"pa",
-	"con",
-	"so",
-	"lo",
-	"pro",
-	"di",
-	"be",
-	"la",
-	"al",
-	"me",
-	"tha",
-	"su",
-	"to",
-	"ch",
-	"no",
-	"uni",
-	"ce",
-	"ha",
-	"pe",
-	"gr",
-	"te",
-	"wit",
-	"fi",
-	"en",
-	"tr",
-	"bi",
-	"li",
-	"bo",
-	"ne",
-	"na",
-	"fro",
-	"the",
-	"us",
-	"cen",
-	"sp",
-	"mi",
-	"si",
-	"ba",
-	"hi",
-	"whi",
-	"fe",
-	"ge",
-	"19",
-	"par",
-	"int",
-	"pl",
-	"he",
-	"ro",
-	"ex",
-	"ref",
-	"we",
-	"le",
-	"20",
-	"for",
-	"wo",
-	"pop",
-	"br",
-	"or",
-	"ac",
-	"pla",
-	"loc",
-	"bir",
-	"sy",
-	"tra",
-	"on",
-	"sa",
-	"ra",
-	"fa",
-	"sc",
-	"sh",
-	"go",
-	"da",
-	"ho",
-	"ea",
-	"it",
-	"ci",
-	"wor",
-	"el",
-	"dis",
-	"mu",
-	"bu",
-	"gre",
-	"fea",
-	"cr",
-	"pre",
-	"ri",
-	"use",
-	"nor",
-	"eng",
-	"cl",
-	"ph",
-	"per",
-	"vi",
-	"cha",
-	"thu",
-	"va",
-	"am",
-	"sou",
-	"kn",
-	"ele",
-	"ga",
-	"ap",
-	"spe",
-	"gn",
-	"rel",
-	"cal",
-	"ta",
-	"inc",
-	"ot",
-	"tow",
-	"kno",
-	"ab",
-	"gni",
-	"do",
-	"gen",
-	"im",
-	"pu",
-	"sys",
-	"as",
-	"ti",
-	"oth",
-	"als",
-	"201",
-	"au",
-	"mar",
-	"ind",
-	"des",
-	"nam",
-	"ki",
-	"pri",
-	"ad",
-	"nu",
-	"cit",
-	"nat",
-	"ve",
-	"man",
-	"cu",
-	"str",
-	"res",
-	"thi",
-	"is",
-	"ter",
-	"of",
-	"lan",
-	"at",
-	"sub",
-	"op",
-	"mea",
-	"rep",
-	"col",
-	"ru",
-	"app",
-	"pol",
-	"fl",
-	"whe",
-	"ser",
-	"som",
-	"du",
-	"mat",
-	"gro",
-	"tw",
-	"af",
-	"thr",
-	"fir",
-	"fou",
-	"are",
-	"car",
-	"em",
-	"suc",
-	"kin",
-	"fu",
-	"hu",
-	"reg",
-	"yo",
-	"lat",
-	"200",
-	"ju",
-	"ty",
-	"mos",
-	"met",
-	"bor",
-	"pen",
-	"pi",
-	"es",
-	"dev",
-	"qu",
-	"bet",
-	"ag",
-	"mor",
-	"fra",
-	"lon",
-	"ja",
-	"my",
-	"ame",
-	"fre",
-	"typ",
-	"ev",
-	"hea",
-
-	"num",
-	"cla",
-	"rec",
-	"ear",
-	"wes",
-	"bas",
-	"bri",
-	"tim",
-	"exp",
-	"mus",
-	"mon",
-	"mod",
-	"gov",
-	"var",
-	"his",
-	"min",
-	"inf",
-	"ins",
-	"18",
-	"sho",
-	"yor",
-	"wr",
-	"gra",
-	"tel",
-	"sec",
-	"lin",
-	"ori",
-	"spa",
-	"myt",
-	"ob",
-	"bl",
-	"oc",
-	"acc",
-
-	"che",
-	"ed",
-	"jo",
-	"hav",
-	"act",
-	"chi",
-	"ai",
-	"cre",
-	"ope",
-
-	"sin",
-	"rom",
-	"dat",
-	"eu",
-	"eas",
-	"vo",
-	"art",
-	"wri",
-	"mil",
-	"dr",
-	"ke",
-	"set",
-	"lea",
-	"imp",
-	"sci",
-	"sto",
-	"sim",
-	"pub",
-	"ov",
-	"def",
-	"emp",
-	"ger",
-	"wer",
-	"pos",
-	"abo",
-	"ver",
-	"ass",
-	"org",
-	"can",
-	"gu",
-	"rea",
-	"gi",
-	"lar",
-	"dec",
-	"cor",
-	"bro",
-	"fun",
-	"dif",
-	"ye",
-	"ove",
-	"isl",
-	"ima",
-	"sup",
-	"bee",
-	"oft",
-	"inv",
-	"med",
-	"bel",
-
-	"{{",
-	"ec",
-	"mai",
-	"und",
-	"ou",
-	"je",
-	"hum",
-	"sig",
-	"tho",
-	"dea",
-	"peo",
-	"fam",
-	"gam",
-	"eve",
-	"boo",
-	"ni",
-	"sm",
-	"geo",
-	"usu",
-	"tu",
-	"mem",
-	"aut",
-	"rig",
-	"eur",
-	"anc",
-	"hig",
-
-	"sea",
-	"nov",
-	"bra",
-	"val",
-	"riv",
-	"net",
-	"sev",
-	"pow",
-	"soc",
-	"chr",
-	"sha",
-	"phy",
-
-	"har",
-	"ant",
-	"all",
-	"ext",
-	"off",
-	"att",
-	"ir",
-	"cap",
-	"sur",
-	"est",
-
-	"dur",
-	"aft",
-	"tri",
-
-	"cas",
-	"yea",
-	"stu",
-	"sol",
-	"mas",
-	"id",
-	"fil",
-	"et",
-	"qua",
-	"wil",
-	"rad",
-	"bot",
-	"her",
-	"equ",
-	"eq",
-	"eco",
-	"phi",
-	"war",
-
-	"cod",
-	"por",
-	"199",
-	"ran",
-	"sam",
-	"dem",
-	"dep",
-	"cat",
-	"ol",
-	"ent",
-	"lit",
-	"sw",
-	"arc",
-	"alt",
-	"hol",
-	"tec",
-	"cel",
-
-	"ana",
-	"obj",
-	"den",
-	"wel",
-	"flo",
-	"fol",
-	"mul",
-	"fic",
-	"mic",
-	"ka",
-	"ide",
-	"tre",
-	"sma",
-	"sen",
-	"sch",
-	"leg",
-	"air",
-	"fin",
-	"foo",
-	"cul",
-	"dir",
-	"ste",
-	"ban",
-	"aus",
-	"bec",
-
-	"198",
-	"bei",
-	"wat",
-	"clo",
-	"mis",
-	"10",
-	"out",
-	"onl",
-	"sco",
-	"hy",
-	"div",
-	"poi",
-	"ord",
-	"gl",
-	"mid",
-	"ei",
-	"cur",
-	"occ",
-	"pas",
-	"hel",
-	"sym",
-	"sl",
-	"mov",
-	"197",
-	"win",
-	"ita",
-	"pat",
-	"eac",
-	"mou",
-	"17",
-	"mad",
-	"giv",
-	"pho",
-	"tak",
-	"pra",
-
-	"fie",
-	"roc",
-	"rat",
-
-	"er",
-	"mot",
-	"lu",
-	"bod",
-	"god",
-	"non",
-
-	"dic",
-	"liv",
-	"mac",
-	"cro",
-	"bar",
-	"{{i",
-	"fac",
-	"up",
-	"il",
-	"fla",
-
-	"ham",
-	"who",
-	"ang",
-	"sk",
-	"spo",
-	"bac",
-	"ep",
-	"wal",
-	"16",
-	"exe",
-	"mak",
-	"mag",
-	"arm",
-	"15",
-	"rul",
-	"tex",
-	"not",
-	"sep",
-	"lig",
-	"joh",
-	"cam",
-	"bla",
-	"bio",
-	"hou",
-	"exa",
-	"det",
-	"196",
-	"han",
-	"enc",
-	"bal",
-	"cri",
-	"bea",
-	"wid",
-	"der",
-
-	"amo",
-	"cer",
-	"rev",
-	"mun",
-	"log",
-	"ani",
-	"rem",
-	"ef",
-	"del",
-	"av",
-	"maj",
-	"alg",
-	"pur",
-	"scr",
-
-	"coa",
-	"cy",
-	"eth",
-	"cir",
-	"ato",
-	"aff",
-	"hom",
-	"eff",
-	"bui",
-	"lif",
-
-	"vir",
-	"ken",
-	"ill",
-	"add",
-	"law",
-	"==e",
-	"chu",
-	"exi",
-	"sel",
-
-	"ic",
-	"vil",
-	"ps",
-	"lev",
-	"hal",
-	"dom",
-	"bre",
-	"and",
-	"usi",
-	"mer",
-
-	"sit",
-	"age",
-	"que",
-	"alo",
-	"vol",
-	"rus",
-	"exc",
-	"dan",
-	"spi",
-
-	"12",
-	"shi",
-	"rou",
-	"hor",
-	"tur",
-	"sof",
-	"dia",
-	"syn",
-	"bc",
-	"sai",
-	"fig",
-	"coo",
-	"ae",
-	"lou",
-	"aro",
-	"run",
-	"rai",
-	"pal",
-	"ene",
-	"eg",
-	"nea",
-	"low",
-	"ala",
-	"eit",
-	"sal",
-	"adv",
-	"afr",
-	"jap",
-	"nuc",
-	"dra",
-	"doc",
-	"tem",
-	"pai",
-	"wea",
-	"mal",
-	"gui",
-	"new",
-	"ano",
-	"san",
-	"ow",
-	"11",
-	"ze",
-	"lis",
-	"dig",
-	"nav",
-	"edi",
-	"poe",
-	"ber",
-	"unt",
-	"vie",
-	"195",
-	"tru",
-	"bat",
-	"abs",
-	"bur",
-	"rol",
-	"mes",
-	"194",
-	"lib",
-
-	"see",
-	"ric",
-	"ko",
-	"ari",
-	"aga",
-	"tit",
-	"lim",
-	"14",
-	"rh",
-	"civ",
-	"bes",
-	"red",
-	"epi",
-
-	"blo",
-	"vis",
-	"fat",
-	"beg",
-	"sca",
-	"ox",
-	"opp",
-	"mol",
-	"dy",
-	"cov",
-	"tes",
-	"ret",
-	"sem",
-	"tro",
-	"jul",
-
-	"las",
-
-	"cau",
-	"13",
-	"was",
-	"she",
-	"wav",
-	"spr",
-	"men",
-	"env",
-	"agr",
-	"rob",
-	"len",
-	"hun",
-	"asp",
-
-	"edu",
-	"bib",
-	"ur",
-	"obs",
-	"fal",
-	"adm",
-	"zi",
-	"fed",
-	"bil",
-	"arg",
-	"tea",
-	"bef",
-	"gal",
-	"dow",
-	"seq",
-	"cli",
-	"swi",
-	"son",
-	"pie",
-	"oct",
-	"hen",
-
-	"vic",
-	"lab",
-	"aug",
-	"ast",
-	"ten",
-	"aw",
-
-	"abb",
-	"jus",
-	"top",
-	"sat",
-	"ii",
-	"beh",
-	"jan",
-	"bus",
-	"bou",
-	"hil",
-	"egy",
-	"awa",
-	"arr",
-	"193",
-	"fai",
-	"psy",
-	"opt",
-
-	"sti",
-	"jun",
-	"esp",
-	"cos",
-	"ben",
-	"ara",
-	"ann",
-	"plu",
-	"os",
-	"mec",
-	"asi",
-	"192",
-	"sil",
-	"pan",
-	"fri",
-	"cho",
-	"ly",
-	"sex",
-	"pap",
-	"fis",
-	"roa",
-	"ren",
-	"2,",
-	"tar",
-	"end",
-	"woo",
-
-	"pac",
-	"lak",
-	"jud",
-	"hyp",
-	"acr",
-	"pet",
-	"tal",
-	"sq",
-	"let",
-	"boa",
-	"one",
-	"swe",
-
-	"dyn",
-	"lik",
-	"jer",
-	"squ",
-	"wha",
-	"pha",
-	"les",
-	"sid",
-
-	"sov",
-	"mex",
-	"fer",
-	"roo",
-	"io",
-	"heb",
-	"cry",
-	"sty",
-	"oce",
-	"goo",
-	"gar",
-	"cra",
-	"bon",
-	"req",
-
-	"vid",
-	"sum",
-	"pic",
-	"you",
-	"tog",
-	"sun",
-	"suf",
-	"rac",
-
-	"lau",
-	"dri",
-	"dar",
-	"alp",
-	"cle",
-	"kil",
-	"glo",
-	"alb",
-	"feb",
-	"ale",
-
-	"mc",
-	"jam",
-	"pit",
-	"day",
-	"dav",
-	"blu",
-	"roy",
-	"pea",
-
-	"ini",
-
-	"191",
-	"iri",
-	"ful",
-	"dau",
-	"aud",
-	"rei",
-	"gla",
-
-	"pot",
-	"dei",
-	"sn",
-	"ora",
-	"hyd",
-	"dou",
-	"web",
-	"rot",
-	"gua",
-	"apr",
-	"ath",
-	"too",
-	"neu",
-
-	"190",
-	"nic",
-	"fiv",
-
-	"nar",
-	"kr",
-	"coi",
-	"ya",
-	"inh",
-	"evo",
-	"emb",
-	"pag",
-	"gol",
-	"die",
-	"ado",
-	"upo",
-	"ire",
-	"cyc",
-	"cop",
-	"ut",
-	"nig",
-	"voi",
-	"tab",
-
-	"jew",
-	"aca",
-	"wou",
-	"flu",
-	"fem",
-	"by",
-	"sla",
-	"ski",
-	"loo",
-	"fan",
-	"ach",
-	"veh",
-
-	"wom",
-
-	"lay",
-	"icd",
-
-	"qui",
-	"ple",
-	"ax",
-	"jac",
-	"imm",
-	"ess",
-	"way",
-	"pau",
-	"ark",
-	"ada",
-	"ul",
-	"pun",
-	"tor",
-
-	"oxf",
-	"nei",
-	"moo",
-	"iss",
-	"fas",
-	"far",
-	"bin",
-	"30",
-	"ven",
-	"hin",
-	"fix",
-
-	"vec",
-
-	"don",
-	"cab",
-	"tot",
-	"mel",
-	"hon",
-
-	"3,",
-	"usa",
-	"siz",
-	"los",
-	"lef",
-	"jur",
-	"its",
-
-	"doe",
-	"clu",
-	"slo",
-	"ris",
-	"old",
-	"abi",
-	"sus",
-	"muc",
-	"hei",
-	"gai",
-	"unc",
-
-	"amp",
-	"phr",
-	"hem",
-	"cus",
-
-	"upp",
-	"own",
-	"tou",
-	"ros",
-	"lor",
-	"bis",
-	"nee",
-	"iso",
-	"ton",
-	"liq",
-	"lie",
-	"how",
-	"189",
-	"tan",
-
-	"isr",
-
-	"dut",
-	"aci",
-	"twi",
-	"pul",
-	"hos",
-	"aer",
-	"tod",
-	"iro",
-	"dn",
-	"rin",
-	"ku",
-	"ava",
-
-	"atl",
-	"19t",
-	"dee",
-	"cru",
-	"pin",
-	"oh",
-
-	"foc",
-	"adj",
-	"zo",
-	"phe",
-	"eli",
-
-	"dru",
-	"25",
-
-	"sug",
-
-	"mix",
-	"goa",
-
-	"nas",
-	"mob",
-	"lam",
-
-	"dam",
-	"apo",
-	"187",
-	"ont",
-	"nin",
-	"evi",
-
-	"edg",
-	"ort",
-	"od",
-	"key",
-	"jef",
-	"fib",
-	"bru",
-
-	"lov",
-	"kan",
-	"wir",
-	"mur",
-	"inp",
-	"gul",
-	"axi",
-	"two",
-	"twe",
-	"ohi",
-	"fli",
-	"fle",
-	"dim",
-	"ama",
-	"sui",
-	"[[s",
-	"nec",
-	"may",
-	"21",
-	"wei",
-	"inn",
-	"edw",
-	"bul",
-	"sac",
-	"lac",
-	"ia",
-	"fee",
-	"eva",
-	"[[c",
-
-	"26",
-	"una",
-	"sau",
-	"sar",
-	"haw",
-	"rid",
-	"eig",
-	"bab",
-	"vio",
-	"186",
-	"om",
-
-	"duc",
-	"dio",
-	"deg",
-	"ali",
-	"urb",
-	"rap",
-	"ny",
-	"jou",
-	"gat",
-	"188",
-	"}}",
-	"orb",
-	"nob",
-	"mig",
-	"50",
-	"ion",
-	"etc",
-	"dip",
-	"bud",
-	"ave",
-	"cui",
-	"4,",
-	"wif",
-	"nom",
-	"jos",
-
-	"atm",
-	"alc",
-	"py",
-
-	"ib",
-	"bol",
-
-	"max",
-	"joi",
-	"gas",
-
-	"bom",
-	"amb",
-	"22",
-	"wis",
-
-	"nou",
-	"neo",
-
-	"alm",
-	"za",
-	"vot",
-	"ves",
-	"sul",
-	"oa",
-	"kh",
-	"[[a",
-	"neg",
-
-	"fif",
-	"dre",
-	"dor",
-	"cav",
-	"but",
-	"bos",
-	"rit",
-	"emi",
-	"map",
-	"fru",
-	"28",
-	"oly",
-	"fut",
-	"esc",
-	"40",
-	"van",
-	"sor",
-
-	"mys",
-	"mee",
-	"hai",
-	"gau",
-	"ak",
-	"27",
-
-	"oi",
-	"kor",
-	"uk",
-	"tai",
-	"sis",
-	"pel",
-	"jes",
-	"ira",
-	"23",
-	"20t",
-	"tun",
-	"tax",
-
-	"nan",
-}
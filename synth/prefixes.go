@@ -0,0 +1,168 @@
+package synth
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+)
+
+// TypingModel describes how users type queries into a search box with autocomplete
+type TypingModel struct {
+	// MinPrefix is the number of characters typed before the first suggestion request
+	MinPrefix int
+	// MaxPrefix is the number of characters after which users stop typing, 0 to type whole queries
+	MaxPrefix int
+	// StopProb is the probability of stopping after each suggestion request, e.g. because a suggestion was picked
+	StopProb float64
+	// Zipf is the exponent of the Zipfian popularity of the queries, which must be greater than 1. The higher it is,
+	// the more the most popular queries dominate
+	Zipf float64
+}
+
+// DefaultTypingModel requests suggestions from the second character on, stopping after each keystroke with a 20%
+// probability
+var DefaultTypingModel = TypingModel{
+	MinPrefix: 2,
+	StopProb:  0.2,
+	Zipf:      1.1,
+}
+
+// typingSession is a query being typed by a client, with the random sources of the client
+type typingSession struct {
+	query []rune
+	typed int
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+}
+
+// PrefixGenerator generates the prefixes sent to an autocompleter by users typing queries one keystroke at a time.
+// Queries are picked by Zipfian popularity, most popular first, and each client types its own queries
+type PrefixGenerator struct {
+	mtx      sync.Mutex
+	queries  []string
+	model    TypingModel
+	seed     int64
+	sessions map[int]*typingSession
+}
+
+// NewPrefixGenerator creates a prefix generator for the given queries. The popularity of the queries follows their
+// score. Each client draws from its own random source, derived from the seed and the client, so the same seed
+// generates the same prefixes for each client however the clients interleave
+func NewPrefixGenerator(queries []index.Suggestion, model TypingModel, seed int64) (*PrefixGenerator, error) {
+	if model.Zipf <= 1 {
+		return nil, errors.New("the zipf exponent must be greater than 1")
+	}
+	if model.MinPrefix < 1 {
+		model.MinPrefix = 1
+	}
+
+	sorted := make([]index.Suggestion, 0, len(queries))
+	for _, q := range queries {
+		q.Term = strings.ToLower(strings.TrimSpace(q.Term))
+		if len([]rune(q.Term)) >= model.MinPrefix {
+			sorted = append(sorted, q)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, errors.New("no queries to generate prefixes from")
+	}
+	sort.SliceStable(sorted, func(x, y int) bool { return sorted[x].Score > sorted[y].Score })
+
+	g := &PrefixGenerator{
+		queries:  make([]string, len(sorted)),
+		model:    model,
+		seed:     seed,
+		sessions: map[int]*typingSession{},
+	}
+	for n, q := range sorted {
+		g.queries[n] = q.Term
+	}
+	return g, nil
+}
+
+// Len returns the number of queries prefixes are generated from
+func (g *PrefixGenerator) Len() int {
+	return len(g.queries)
+}
+
+// Next returns the next prefix typed by a client. When the client stops typing its current query, it starts typing
+// a new query picked by popularity
+func (g *PrefixGenerator) Next(client int) string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	s := g.sessions[client]
+	if s == nil {
+		s = &typingSession{rng: rand.New(rand.NewSource(g.seed + int64(client)))}
+		s.zipf = rand.NewZipf(s.rng, g.model.Zipf, 1, uint64(len(g.queries)-1))
+		g.sessions[client] = s
+	}
+	if s.query == nil || g.done(s) {
+		s.query = []rune(g.queries[s.zipf.Uint64()])
+		s.typed = g.model.MinPrefix - 1
+	}
+
+	// suggestions are not requested after typing a space, but after the next character
+	s.typed++
+	for s.typed < len(s.query) && unicode.IsSpace(s.query[s.typed-1]) {
+		s.typed++
+	}
+	return string(s.query[:s.typed])
+}
+
+// done tells whether the client stops typing the query of a session
+func (g *PrefixGenerator) done(s *typingSession) bool {
+	if s.typed >= len(s.query) || (g.model.MaxPrefix > 0 && s.typed >= g.model.MaxPrefix) {
+		return true
+	}
+	return s.rng.Float64() < g.model.StopProb
+}
+
+// LoadQueries loads queries from a query log, one query per line, optionally followed by a tab and the number of
+// times it was searched. Repeated queries add up
+func LoadQueries(fileName string) ([]index.Suggestion, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	counts := map[string]float64{}
+	order := []string{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := scanner.Text()
+		count := 1.0
+		if tab := strings.LastIndexByte(line, '\t'); tab >= 0 {
+			if count, err = strconv.ParseFloat(strings.TrimSpace(line[tab+1:]), 64); err != nil {
+				return nil, err
+			}
+			line = line[:tab]
+		}
+		q := strings.TrimSpace(line)
+		if q == "" {
+			continue
+		}
+		if _, found := counts[q]; !found {
+			order = append(order, q)
+		}
+		counts[q] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]index.Suggestion, len(order))
+	for n, q := range order {
+		ret[n] = index.Suggestion{Term: q, Score: counts[q]}
+	}
+	return ret, nil
+}
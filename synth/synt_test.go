@@ -2,7 +2,11 @@ package synth
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/RedisLabs/RediSearchBenchmark/index"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDocumentGenerator(t *testing.T) {
@@ -16,6 +20,50 @@ func TestDocumentGenerator(t *testing.T) {
 	}
 }
 
+func TestPrefixGenerator(t *testing.T) {
+	queries := []index.Suggestion{
+		{Term: "rare query", Score: 1}, {Term: "Hello World", Score: 100}, {Term: "foo", Score: 10}, {Term: "x", Score: 50},
+	}
+	_, err := NewPrefixGenerator(queries, TypingModel{Zipf: 1}, 1)
+	assert.Error(t, err)
+
+	gen, err := NewPrefixGenerator(queries, DefaultTypingModel, 42)
+	assert.NoError(t, err)
+	// queries shorter than the first prefix are dropped
+	assert.Equal(t, 3, gen.Len())
+
+	other, _ := NewPrefixGenerator(queries, DefaultTypingModel, 42)
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		p := gen.Next(i % 4)
+		// the same seed types the same prefixes
+		assert.Equal(t, p, other.Next(i%4))
+		assert.True(t, len(p) >= 2)
+		assert.False(t, strings.HasSuffix(p, " "))
+		counts[p]++
+	}
+	// a client types the same prefixes whatever the other clients do
+	alone, _ := NewPrefixGenerator(queries, DefaultTypingModel, 42)
+	mixed, _ := NewPrefixGenerator(queries, DefaultTypingModel, 42)
+	for i := 0; i < 100; i++ {
+		mixed.Next(1)
+		mixed.Next(2)
+		assert.Equal(t, alone.Next(0), mixed.Next(0))
+	}
+
+	// the most popular query is typed the most
+	assert.True(t, counts["he"] > counts["fo"])
+	assert.True(t, counts["fo"] > counts["ra"])
+
+	// each client types one keystroke at a time
+	gen, _ = NewPrefixGenerator([]index.Suggestion{{Term: "hello world", Score: 1}}, TypingModel{MinPrefix: 4, Zipf: 2}, 1)
+	typed := []string{}
+	for i := 0; i < 9; i++ {
+		typed = append(typed, gen.Next(0))
+	}
+	assert.Equal(t, []string{"hell", "hello", "hello w", "hello wo", "hello wor", "hello worl", "hello world", "hell", "hello"}, typed)
+}
+
 func BenchmarkGenerator(b *testing.B) {
 	g := NewDocumentGenerator(1000, map[string][2]int{"title": {10, 15}})
 	for i := 0; i < b.N; i++ {